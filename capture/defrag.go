@@ -0,0 +1,184 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package capture
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/ip4defrag"
+	"github.com/google/gopacket/layers"
+	"github.com/pkg/errors"
+)
+
+// fragmentTimeout is the time after which incomplete datagrams are
+// discarded.
+const fragmentTimeout = time.Minute
+
+// ip6MaximumFragments is the maximum number of fragments of an IPv6
+// datagram.
+const ip6MaximumFragments = 64
+
+// Defragmenter reassembles fragmented IPv4 and IPv6 datagrams.
+type Defragmenter struct {
+	ip4 *ip4defrag.IPv4Defragmenter
+	ip6 map[ip6FragmentKey]*ip6Fragments
+}
+
+type ip6FragmentKey struct {
+	src, dst       string
+	identification uint32
+}
+
+type ip6Fragments struct {
+	header    *layers.IPv6
+	fragments []*layers.IPv6Fragment
+	last      time.Time
+}
+
+// NewDefragmenter returns a new defragmenter.
+func NewDefragmenter() *Defragmenter {
+	return &Defragmenter{
+		ip4: ip4defrag.NewIPv4Defragmenter(),
+		ip6: make(map[ip6FragmentKey]*ip6Fragments),
+	}
+}
+
+// Defrag returns the packet when it is not fragmented or the packet of the
+// reassembled datagram when it is the missing fragment. Nil is returned
+// while fragments are missing.
+func (d *Defragmenter) Defrag(packet gopacket.Packet) (gopacket.Packet, error) {
+	t := packet.Metadata().Timestamp
+	d.discard(t)
+
+	if ip4, ok := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4); ok {
+		out, err := d.ip4.DefragIPv4WithTimestamp(ip4, t)
+		if err != nil {
+			return nil, errors.Wrap(err, "defrag ipv4 failed")
+		}
+		if out == nil {
+			return nil, nil
+		}
+		if out == ip4 {
+			return packet, nil
+		}
+		return reassembled(packet, out, gopacket.Payload(out.Payload))
+	}
+
+	if frag, ok := packet.Layer(layers.LayerTypeIPv6Fragment).(*layers.IPv6Fragment); ok {
+		ip6, _ := packet.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+		if ip6 == nil {
+			return nil, errors.New("defrag ipv6 failed: no ipv6 header")
+		}
+		return d.defragIPv6(packet, ip6, frag)
+	}
+
+	return packet, nil
+}
+
+// reassembled returns a new packet, with the capture info of the packet
+// containing the last fragment, of the network layer and its payload.
+func reassembled(packet gopacket.Packet, network gopacket.SerializableLayer, payload gopacket.Payload) (gopacket.Packet, error) {
+	buffer := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	err := gopacket.SerializeLayers(buffer, options, network, payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "reassemble failed")
+	}
+
+	out := gopacket.NewPacket(buffer.Bytes(), network.LayerType(), gopacket.Default)
+	*out.Metadata() = *packet.Metadata()
+	out.Metadata().CaptureLength = len(buffer.Bytes())
+	out.Metadata().Length = len(buffer.Bytes())
+
+	return out, nil
+}
+
+// defragIPv6 adds the fragment and returns the packet of the datagram when
+// all fragments are seen.
+func (d *Defragmenter) defragIPv6(packet gopacket.Packet, ip6 *layers.IPv6, frag *layers.IPv6Fragment) (gopacket.Packet, error) {
+	key := ip6FragmentKey{ip6.SrcIP.String(), ip6.DstIP.String(), frag.Identification}
+	f, ok := d.ip6[key]
+	if !ok {
+		f = &ip6Fragments{}
+		d.ip6[key] = f
+	}
+	f.last = packet.Metadata().Timestamp
+	if frag.FragmentOffset == 0 {
+		f.header = ip6
+	}
+	f.fragments = append(f.fragments, frag)
+
+	if len(f.fragments) > ip6MaximumFragments {
+		delete(d.ip6, key)
+		return nil, errors.New("defrag ipv6 failed: too many fragments")
+	}
+
+	payload, complete := f.payload()
+	if !complete {
+		return nil, nil
+	}
+	delete(d.ip6, key)
+
+	header := *f.header
+	header.NextHeader = f.fragments[0].NextHeader
+	header.HopByHop = nil
+	return reassembled(packet, &header, payload)
+}
+
+// payload returns the reassembled payload when all fragments are seen.
+func (f *ip6Fragments) payload() (gopacket.Payload, bool) {
+	if f.header == nil {
+		return nil, false
+	}
+
+	sort.Slice(f.fragments, func(i, j int) bool {
+		return f.fragments[i].FragmentOffset < f.fragments[j].FragmentOffset
+	})
+
+	var payload []byte
+	for _, frag := range f.fragments {
+		offset := int(frag.FragmentOffset) * 8
+		if offset > len(payload) {
+			return nil, false
+		}
+		payload = append(payload[:offset], frag.LayerPayload()...)
+		if !frag.MoreFragments {
+			return payload, true
+		}
+	}
+
+	return nil, false
+}
+
+// discard removes the incomplete datagrams without fragments in the
+// fragment timeout.
+func (d *Defragmenter) discard(t time.Time) {
+	d.ip4.DiscardOlderThan(t.Add(-fragmentTimeout))
+	for key, f := range d.ip6 {
+		if t.Sub(f.last) > fragmentTimeout {
+			delete(d.ip6, key)
+		}
+	}
+}
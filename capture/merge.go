@@ -0,0 +1,108 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package capture
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/google/gopacket"
+)
+
+// Packet is a packet captured on an interface.
+type Packet struct {
+	gopacket.Packet
+	Interface string
+}
+
+// Source is the packets captured on an interface.
+type Source struct {
+	Interface string
+	Packets   <-chan gopacket.Packet
+}
+
+// Merge merges the packets of the sources in one stream, ordered by their
+// capture timestamp. Packets are held for the window, so packets captured
+// at the same time on another interface can be sorted in. The stream is
+// closed when all sources are closed.
+func Merge(window time.Duration, sources ...Source) <-chan Packet {
+	in := make(chan Packet)
+	done := make(chan struct{})
+	for _, source := range sources {
+		go func(source Source) {
+			for packet := range source.Packets {
+				in <- Packet{packet, source.Interface}
+			}
+			done <- struct{}{}
+		}(source)
+	}
+
+	out := make(chan Packet)
+	go func() {
+		defer close(out)
+
+		var queue packetQueue
+		ticker := time.NewTicker(window / 2)
+		defer ticker.Stop()
+
+		for open := len(sources); open > 0; {
+			select {
+			case packet := <-in:
+				heap.Push(&queue, packet)
+			case <-done:
+				open--
+			case now := <-ticker.C:
+				for len(queue) > 0 && now.Sub(queue[0].Metadata().Timestamp) >= window {
+					out <- heap.Pop(&queue).(Packet)
+				}
+			}
+		}
+
+		for len(queue) > 0 {
+			out <- heap.Pop(&queue).(Packet)
+		}
+	}()
+
+	return out
+}
+
+// packetQueue implements heap.Interface, the oldest packet first.
+type packetQueue []Packet
+
+func (q packetQueue) Len() int { return len(q) }
+
+func (q packetQueue) Less(i, j int) bool {
+	return q[i].Metadata().Timestamp.Before(q[j].Metadata().Timestamp)
+}
+
+func (q packetQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *packetQueue) Push(x interface{}) { *q = append(*q, x.(Packet)) }
+
+func (q *packetQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	x := old[n-1]
+	*q = old[:n-1]
+	return x
+}
@@ -0,0 +1,126 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package capture contains the captured packets of the packet forwarder
+// traffic and their metadata.
+package capture
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/pkg/errors"
+)
+
+// Reasons a captured packet has no record.
+var (
+	ErrNoNetworkLayer   = errors.New("no network layer")
+	ErrNoTransportLayer = errors.New("no transport layer")
+	ErrNotUDP           = errors.New("not udp")
+)
+
+// Record is a captured UDP packet with its capture metadata.
+type Record struct {
+	Sequence        uint64    // monotonic sequence number of the capture
+	Timestamp       time.Time // capture timestamp
+	Interface       string
+	Endpoint        string // server endpoint the packet is sent from or to
+	Length          int    // length of the frame on the wire
+	SourceIP        net.IP
+	SourcePort      uint16
+	DestinationIP   net.IP
+	DestinationPort uint16
+	Payload         []byte // UDP payload
+	Packet          gopacket.Packet
+}
+
+// NewRecord returns the record of a packet captured on the interface.
+func NewRecord(sequence uint64, iface string, packet gopacket.Packet) (*Record, error) {
+	r := &Record{
+		Sequence:  sequence,
+		Timestamp: packet.Metadata().Timestamp,
+		Interface: iface,
+		Length:    packet.Metadata().Length,
+		Packet:    packet,
+	}
+
+	network := packet.NetworkLayer()
+	if network == nil {
+		return r, ErrNoNetworkLayer
+	}
+	r.SourceIP = net.IP(network.NetworkFlow().Src().Raw())
+	r.DestinationIP = net.IP(network.NetworkFlow().Dst().Raw())
+
+	transport := packet.TransportLayer()
+	if transport == nil {
+		return r, ErrNoTransportLayer
+	}
+	if transport.LayerType() != layers.LayerTypeUDP {
+		return r, ErrNotUDP
+	}
+	src, dst := transport.TransportFlow().Endpoints()
+	if len(src.Raw()) != 2 || len(dst.Raw()) != 2 {
+		return r, errors.New("new record failed: invalid transport layer")
+	}
+	r.SourcePort = uint16(src.Raw()[0])<<8 | uint16(src.Raw()[1])
+	r.DestinationPort = uint16(dst.Raw()[0])<<8 | uint16(dst.Raw()[1])
+	r.Payload = transport.LayerPayload()
+
+	return r, nil
+}
+
+// Source returns the source address and port.
+func (r *Record) Source() string {
+	return endpoint(r.SourceIP, r.SourcePort)
+}
+
+// Destination returns the destination address and port.
+func (r *Record) Destination() string {
+	return endpoint(r.DestinationIP, r.DestinationPort)
+}
+
+func endpoint(ip net.IP, port uint16) string {
+	if ip == nil {
+		return ""
+	}
+	return net.JoinHostPort(ip.String(), strconv.Itoa(int(port)))
+}
+
+// Fields returns the capture metadata as log fields.
+func (r *Record) Fields() log.Fields {
+	fields := log.Fields{
+		"sequence":     r.Sequence,
+		"capture time": r.Timestamp,
+		"interface":    r.Interface,
+		"frame length": r.Length,
+		"source":       r.Source(),
+		"destination":  r.Destination(),
+	}
+	if len(r.Endpoint) > 0 {
+		fields["server endpoint"] = r.Endpoint
+	}
+	return fields
+}
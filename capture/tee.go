@@ -0,0 +1,199 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package capture
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/pkg/errors"
+)
+
+// teeTimeFormat is the time format in the file names, it sorts
+// chronologically.
+const teeTimeFormat = "20060102T150405.000000"
+
+// Tee writes the raw captured packets to pcapng files, rotated by size and
+// time. Only the newest files are kept when a retention is set.
+type Tee struct {
+	prefix    string
+	maxSize   int64         // rotate when a file reaches this size in bytes, 0 disables
+	maxAge    time.Duration // rotate when a file is open this long, 0 disables
+	retention int           // number of files to keep, 0 keeps all
+	intf      pcapgo.NgInterface
+
+	file   *os.File
+	writer *pcapgo.NgWriter
+	size   countingWriter
+	opened time.Time
+}
+
+// countingWriter counts the bytes written to the file.
+type countingWriter struct {
+	file *os.File
+	n    int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// NewTee returns a tee writing files named <prefix>-<time>.pcapng with the
+// packets captured on the interface with the given link type and filter.
+func NewTee(prefix, iface, filter string, linkType layers.LinkType, maxSize int64, maxAge time.Duration, retention int) *Tee {
+	return &Tee{
+		prefix:    prefix,
+		maxSize:   maxSize,
+		maxAge:    maxAge,
+		retention: retention,
+		intf: pcapgo.NgInterface{
+			Name:                iface,
+			Filter:              filter,
+			OS:                  runtime.GOOS,
+			LinkType:            linkType,
+			TimestampResolution: 9,
+		},
+	}
+}
+
+// WritePacket writes a captured packet, the file is rotated before the
+// packet when it is full or too old.
+func (t *Tee) WritePacket(ci gopacket.CaptureInfo, data []byte) error {
+	if t.writer != nil && t.full(ci.Timestamp) {
+		err := t.Close()
+		if err != nil {
+			return errors.Wrap(err, "rotate failed")
+		}
+	}
+
+	if t.writer == nil {
+		err := t.open(ci.Timestamp)
+		if err != nil {
+			return errors.Wrap(err, "rotate failed")
+		}
+	}
+
+	err := t.writer.WritePacket(ci, data)
+	if err != nil {
+		return errors.Wrap(err, "write packet failed")
+	}
+
+	// flush every packet, so the file can be inspected while capturing
+	err = t.writer.Flush()
+	if err != nil {
+		return errors.Wrap(err, "write packet failed")
+	}
+
+	return nil
+}
+
+// full returns true when the file must be rotated.
+func (t *Tee) full(now time.Time) bool {
+	if t.maxSize > 0 && t.size.n >= t.maxSize {
+		return true
+	}
+	if t.maxAge > 0 && now.Sub(t.opened) >= t.maxAge {
+		return true
+	}
+	return false
+}
+
+// open creates a new file and removes the files outside the retention.
+func (t *Tee) open(now time.Time) error {
+	dir := filepath.Dir(t.prefix)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, "open file failed")
+	}
+
+	name := fmt.Sprintf("%s-%s.pcapng", t.prefix, now.UTC().Format(teeTimeFormat))
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return errors.Wrap(err, "open file failed")
+	}
+
+	t.file = f
+	t.size = countingWriter{file: f}
+	t.opened = now
+
+	options := pcapgo.DefaultNgWriterOptions
+	options.SectionInfo.Application = "lora-logger"
+	t.writer, err = pcapgo.NewNgWriterInterface(&t.size, t.intf, options)
+	if err != nil {
+		f.Close()
+		t.file, t.writer = nil, nil
+		return errors.Wrap(err, "open file failed")
+	}
+
+	return t.removeOld()
+}
+
+// removeOld removes the oldest files when there are more than the
+// retention.
+func (t *Tee) removeOld() error {
+	if t.retention <= 0 {
+		return nil
+	}
+
+	files, err := filepath.Glob(t.prefix + "-*.pcapng")
+	if err != nil {
+		return errors.Wrap(err, "remove old files failed")
+	}
+	sort.Strings(files)
+
+	for len(files) > t.retention {
+		err = os.Remove(files[0])
+		if err != nil {
+			return errors.Wrap(err, "remove old files failed")
+		}
+		files = files[1:]
+	}
+
+	return nil
+}
+
+// Close flushes and closes the current file.
+func (t *Tee) Close() error {
+	if t.writer == nil {
+		return nil
+	}
+
+	err := t.writer.Flush()
+	closeErr := t.file.Close()
+	t.file, t.writer = nil, nil
+	if err != nil {
+		return errors.Wrap(err, "close failed")
+	}
+	if closeErr != nil {
+		return errors.Wrap(closeErr, "close failed")
+	}
+	return nil
+}
@@ -23,21 +23,40 @@ package cmd
 import (
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/apex/log"
-	"github.com/google/gopacket/pcap"
+	"github.com/bullettime/lora-logger/region"
 	"github.com/segmentio/go-prompt"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v2"
 )
 
+// yamlConfig is the configuration file written by configure. Settings that
+// were not asked for, or not answered, are left out so their defaults apply.
 type yamlConfig struct {
-	Device      string `yaml:"device"`
-	Host        string `yaml:"host"`
-	Port        int    `yaml:"port"`
-	Promiscuous bool   `yaml:"promiscuous"`
-	Timeout     int    `yaml:"timeout"`
+	Device         string   `yaml:"device"`
+	Devices        []string `yaml:"devices,omitempty"`
+	Host           string   `yaml:"host"`
+	Port           int      `yaml:"port"`
+	Endpoints      []string `yaml:"endpoints,omitempty"`
+	Promiscuous    bool     `yaml:"promiscuous"`
+	Timeout        int      `yaml:"timeout"`
+	Keys           string   `yaml:"keys,omitempty"`
+	Region         string   `yaml:"region,omitempty"`
+	SubBand        *int     `yaml:"sub_band,omitempty"`
+	ACKTimeout     *int     `yaml:"ack_timeout,omitempty"`
+	GatewayTimeout *int     `yaml:"gateway_timeout,omitempty"`
+	PcapPrefix     string   `yaml:"pcap_prefix,omitempty"`
+	PcapMaxSize    *int     `yaml:"pcap_max_size,omitempty"`
+	PcapMaxAge     *int     `yaml:"pcap_max_age,omitempty"`
+	PcapRetention  *int     `yaml:"pcap_retention,omitempty"`
+	LoRaTapFile    string   `yaml:"loratap_file,omitempty"`
+	StatsInterval  *int     `yaml:"stats_interval,omitempty"`
+	ProxyServer    string   `yaml:"proxy_server,omitempty"`
+	ServeDownlinks string   `yaml:"serve_downlinks,omitempty"`
+	ServeAPI       string   `yaml:"serve_api,omitempty"`
 }
 
 // configureCmd represents the configure command
@@ -51,22 +70,38 @@ Various different values for settings that are needed to acquire the traffic fro
 the packet forwarder are asked to choose.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		var (
-			newDevice      string
-			newHost        string
-			newPort        int
-			newPromiscuous bool
-			newTimeout     int
-			err            error
+			newDevice         string
+			newDevices        []string
+			newHost           string
+			newPort           int
+			newEndpoints      []string
+			newPromiscuous    bool
+			newTimeout        int
+			newKeys           string
+			newRegion         string
+			newSubBand        *int
+			newACKTimeout     *int
+			newGatewayTimeout *int
+			newPcapPrefix     string
+			newPcapMaxSize    *int
+			newPcapMaxAge     *int
+			newPcapRetention  *int
+			newLoRaTapFile    string
+			newStatsInterval  *int
+			newProxyServer    string
+			newServeDownlinks string
+			newServeAPI       string
+			err               error
 		)
 
 		// Find all devices
-		devices, err := pcap.FindAllDevs()
+		deviceList, err := findDevices()
 		if err == nil {
-			var deviceList []string
-			for _, device := range devices {
-				deviceList = append(deviceList, device.Name)
-			}
 			newDevice = deviceList[prompt.Choose("device", deviceList)]
+			newDevices = append(newDevices, newDevice)
+			for prompt.Confirm("capture on another device as well [yes/no]") {
+				newDevices = append(newDevices, deviceList[prompt.Choose("device", deviceList)])
+			}
 		} else {
 			log.WithError(err).Error("failed setting device")
 		}
@@ -79,6 +114,13 @@ the packet forwarder are asked to choose.`,
 			log.WithField("new port", portS).WithError(err).Warn("failed setting port (is it an integer?)")
 		}
 
+		endpointsS := prompt.String("server endpoints as host:port, comma separated [empty for the host and port above]")
+		for _, endpoint := range strings.Split(endpointsS, ",") {
+			if endpoint = strings.TrimSpace(endpoint); len(endpoint) > 0 {
+				newEndpoints = append(newEndpoints, endpoint)
+			}
+		}
+
 		newPromiscuous = prompt.Confirm("enable promiscuous mode (enable only to experiment) [yes/no]")
 
 		timeoutS := prompt.StringRequired("capture packets every x seconds [-1 for continuous]")
@@ -87,12 +129,60 @@ the packet forwarder are asked to choose.`,
 			log.WithField("new timeout", timeoutS).WithError(err).Warn("failed setting timeout (is it an integer?)")
 		}
 
+		newKeys = prompt.String("device keys yaml file/directory [empty for none]")
+
+		regionList := append([]string{"none"}, region.Names()...)
+		if i := prompt.Choose("region", regionList); i > 0 {
+			newRegion = regionList[i]
+
+			newSubBand = promptInt("sub-band [0 for all channels]", "sub-band", 0)
+		}
+
+		newACKTimeout = promptInt("report missing acknowledgements after x seconds [empty for 5]", "ack timeout", 1)
+
+		newGatewayTimeout = promptInt("report silent gateways after x seconds [empty for 60]", "gateway timeout", 1)
+
+		newPcapPrefix = prompt.String("pcapng file prefix [empty for none]")
+		if len(newPcapPrefix) > 0 {
+			newPcapMaxSize = promptInt("rotate pcapng files after x megabytes [0 for no limit, empty for 100]", "pcap max size", 0)
+
+			newPcapMaxAge = promptInt("rotate pcapng files after x seconds [0 for no limit, empty for 3600]", "pcap max age", 0)
+
+			newPcapRetention = promptInt("keep the x newest pcapng files [0 for all]", "pcap retention", 0)
+		}
+
+		newLoRaTapFile = prompt.String("loratap export file [empty for none]")
+
+		newStatsInterval = promptInt("log capture statistics every x seconds [0 for never, empty for 60]", "stats interval", 0)
+
+		newProxyServer = prompt.String("proxy network server host:port [empty for the host and port above]")
+
+		newServeDownlinks = prompt.String("serve downlinks json file [empty for none]")
+
+		newServeAPI = prompt.String("serve downlink api address host:port [empty for none]")
+
 		newConfig := &yamlConfig{
-			Device:      newDevice,
-			Host:        newHost,
-			Port:        newPort,
-			Promiscuous: newPromiscuous,
-			Timeout:     newTimeout,
+			Device:         newDevice,
+			Devices:        newDevices,
+			Host:           newHost,
+			Port:           newPort,
+			Endpoints:      newEndpoints,
+			Promiscuous:    newPromiscuous,
+			Timeout:        newTimeout,
+			Keys:           newKeys,
+			Region:         newRegion,
+			SubBand:        newSubBand,
+			ACKTimeout:     newACKTimeout,
+			GatewayTimeout: newGatewayTimeout,
+			PcapPrefix:     newPcapPrefix,
+			PcapMaxSize:    newPcapMaxSize,
+			PcapMaxAge:     newPcapMaxAge,
+			PcapRetention:  newPcapRetention,
+			LoRaTapFile:    newLoRaTapFile,
+			StatsInterval:  newStatsInterval,
+			ProxyServer:    newProxyServer,
+			ServeDownlinks: newServeDownlinks,
+			ServeAPI:       newServeAPI,
 		}
 
 		output, err := yaml.Marshal(newConfig)
@@ -118,6 +208,24 @@ the packet forwarder are asked to choose.`,
 	},
 }
 
+// promptInt asks for an integer setting of at least min, an invalid answer
+// is asked again. Nil is returned for an empty answer, so the setting keeps
+// its default.
+func promptInt(label, name string, min int) *int {
+	for {
+		s := strings.TrimSpace(prompt.String(label))
+		if len(s) == 0 {
+			return nil
+		}
+
+		i, err := strconv.Atoi(s)
+		if err == nil && i >= min {
+			return &i
+		}
+		log.WithField("new "+name, s).WithField("min", min).Warnf("failed setting %s (is it an integer?)", name)
+	}
+}
+
 func init() {
 	RootCmd.AddCommand(configureCmd)
 
@@ -0,0 +1,619 @@
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/bullettime/lora-logger/capture"
+	"github.com/bullettime/lora-logger/keystore"
+	"github.com/bullettime/lora-logger/loratap"
+	"github.com/bullettime/lora-logger/protocol"
+	"github.com/bullettime/lora-logger/region"
+	"github.com/google/gopacket"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	// the pipeline settings are shared by start, read, proxy and serve
+	viper.SetDefault("ack_timeout", 5)
+	viper.SetDefault("gateway_timeout", 60)
+	viper.SetDefault("stats_interval", 60)
+}
+
+// pipeline contains the state kept across the captured packets.
+type pipeline struct {
+	sequence   uint64
+	endpoints  []serverEndpoint // only packets from or to the endpoints are handled
+	defrag     *capture.Defragmenter
+	skipped    map[string]uint64            // skipped packets by reason
+	failures   map[string]uint64            // protocol decode failures by error class
+	txAcks     map[string]map[string]uint64 // TX_ACK statuses by gateway
+	decrypter  *protocol.Decrypter          // nil when no device keys are configured
+	annotator  *protocol.RegionAnnotator    // nil when no region is configured
+	correlator *protocol.Correlator
+	gateways   *protocol.GatewayTable
+	dutyCycle  *region.DutyCycleMonitor
+	loraTap    *loratap.Writer
+}
+
+// newPipeline returns a pipeline reporting missing acknowledgements and
+// silent gateways after the given timeouts. The duty cycle monitor is
+// optional.
+func newPipeline(ackTimeout, gatewayTimeout time.Duration, dutyCycle *region.DutyCycleMonitor) *pipeline {
+	return &pipeline{
+		defrag:     capture.NewDefragmenter(),
+		skipped:    make(map[string]uint64),
+		failures:   make(map[string]uint64),
+		txAcks:     make(map[string]map[string]uint64),
+		correlator: protocol.NewCorrelator(ackTimeout),
+		gateways:   protocol.NewGatewayTable(gatewayTimeout),
+		dutyCycle:  dutyCycle,
+	}
+}
+
+// loadPipeline returns the pipeline with the configured device keys, channel
+// plan and timeouts.
+func loadPipeline() *pipeline {
+	var (
+		keys           = viper.GetString("keys")
+		regionName     = viper.GetString("region")
+		subBand        = viper.GetInt("sub_band")
+		ackTimeout     = time.Duration(viper.GetInt("ack_timeout")) * time.Second
+		gatewayTimeout = time.Duration(viper.GetInt("gateway_timeout")) * time.Second
+		loraTapFile    = viper.GetString("loratap_file")
+	)
+	log.WithFields(log.Fields{
+		"keys":            keys,
+		"region":          regionName,
+		"sub-band":        subBand,
+		"ack timeout":     ackTimeout,
+		"gateway timeout": gatewayTimeout,
+		"loratap file":    loraTapFile,
+	}).Debug("loaded pipeline settings")
+
+	// Load channel plan
+	var (
+		plan      *region.Plan
+		annotator *protocol.RegionAnnotator
+		dutyCycle *region.DutyCycleMonitor
+	)
+	if len(regionName) > 0 {
+		var err error
+		plan, err = region.Get(regionName, subBand)
+		if err != nil {
+			log.WithError(err).Fatal("load region failed")
+		}
+		annotator = protocol.NewRegionAnnotator(plan)
+		dutyCycle = region.NewDutyCycleMonitor(plan, region.DutyCycleWindow)
+	}
+
+	// Load device keys
+	var decrypter *protocol.Decrypter
+	if len(keys) > 0 {
+		store, err := keystore.Load(keys)
+		if err != nil {
+			log.WithError(err).Fatal("load device keys failed")
+		}
+		decrypter = protocol.NewDecrypter(store, plan)
+		log.WithField("devices", len(store.Devices())).Debug("loaded device keys")
+	}
+
+	p := newPipeline(ackTimeout, gatewayTimeout, dutyCycle)
+	p.decrypter = decrypter
+	p.annotator = annotator
+	p.endpoints = loadEndpoints()
+
+	// Export LoRaTap frames
+	if len(loraTapFile) > 0 {
+		w, err := loratap.Create(loraTapFile)
+		if err != nil {
+			log.WithError(err).Fatal("create loratap file failed")
+		}
+		p.loraTap = w
+	}
+
+	return p
+}
+
+// statsTicks returns a channel ticking at the configured stats interval and
+// a function stopping it. The channel never ticks when the interval is 0.
+func statsTicks() (<-chan time.Time, func()) {
+	interval := time.Duration(viper.GetInt("stats_interval")) * time.Second
+	if interval <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(interval)
+	return ticker.C, ticker.Stop
+}
+
+// close closes the LoRaTap export.
+func (p *pipeline) close() {
+	if p.loraTap != nil {
+		p.loraTap.Close()
+	}
+}
+
+// serverEndpoint is a network server the packet forwarders talk to. An
+// empty host or a zero port matches any.
+type serverEndpoint struct {
+	name string
+	host string
+	port uint16
+	ips  []net.IP
+}
+
+// loadEndpoints returns the configured server endpoints. Without a list of
+// endpoints, the host and port settings are used.
+func loadEndpoints() []serverEndpoint {
+	names := viper.GetStringSlice("endpoints")
+	if len(names) == 0 {
+		host := viper.GetString("host")
+		port := viper.GetInt("port")
+		e := serverEndpoint{host: host, port: uint16(port)}
+		if len(host) > 0 || port != 0 {
+			e.name = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		return []serverEndpoint{resolveEndpoint(e)}
+	}
+
+	endpoints := make([]serverEndpoint, 0, len(names))
+	for _, name := range names {
+		e := serverEndpoint{name: name, host: name}
+		if host, port, err := net.SplitHostPort(name); err == nil {
+			e.host = host
+			if len(port) > 0 {
+				n, err := strconv.ParseUint(port, 10, 16)
+				if err != nil {
+					log.WithError(err).WithField("endpoint", name).Fatal("invalid endpoint port")
+				}
+				e.port = uint16(n)
+			}
+		}
+		endpoints = append(endpoints, resolveEndpoint(e))
+	}
+	log.WithField("endpoints", names).Debug("loaded endpoints")
+
+	return endpoints
+}
+
+// resolveEndpoint looks up the addresses of the endpoint host.
+func resolveEndpoint(e serverEndpoint) serverEndpoint {
+	if len(e.host) == 0 {
+		return e
+	}
+	ips, err := net.LookupIP(e.host)
+	if err != nil {
+		log.WithError(err).WithField("host", e.host).Fatal("resolve endpoint failed")
+	}
+	e.ips = ips
+	return e
+}
+
+// matches returns whether the packet of the record is sent from or to the
+// endpoint.
+func (e serverEndpoint) matches(record *capture.Record) bool {
+	return e.matchesAddress(record.SourceIP, record.SourcePort) ||
+		e.matchesAddress(record.DestinationIP, record.DestinationPort)
+}
+
+func (e serverEndpoint) matchesAddress(ip net.IP, port uint16) bool {
+	if e.port != 0 && e.port != port {
+		return false
+	}
+	if len(e.host) == 0 {
+		return true
+	}
+	for _, endpointIP := range e.ips {
+		if endpointIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// endpoint returns the endpoint the packet of the record is sent from or
+// to.
+func (p *pipeline) endpoint(record *capture.Record) (serverEndpoint, bool) {
+	for _, e := range p.endpoints {
+		if e.matches(record) {
+			return e, true
+		}
+	}
+	return serverEndpoint{}, false
+}
+
+// filter returns the BPF filter for the traffic of the packet forwarder
+// with the configured endpoints. IP fragments are always passed, as only
+// the first IPv4 fragment contains the port (and IPv6 fragments are not
+// recognised as udp), the port is checked after reassembly.
+func (p *pipeline) filter() string {
+	var (
+		buffer  bytes.Buffer
+		hosts   []string
+		anyHost bool
+	)
+	buffer.WriteString("(")
+	for _, e := range p.endpoints {
+		buffer.WriteString("(udp")
+		if e.port != 0 {
+			buffer.WriteString(" and port ")
+			buffer.WriteString(strconv.Itoa(int(e.port)))
+		}
+		if len(e.host) > 0 {
+			buffer.WriteString(" and host ")
+			buffer.WriteString(e.host)
+			hosts = append(hosts, "host "+e.host)
+		} else {
+			anyHost = true
+		}
+		buffer.WriteString(") or ")
+	}
+	buffer.WriteString("(((ip[6:2] & 0x1fff != 0) or (ip6 and ip6[6] == 44))")
+	if !anyHost && len(hosts) > 0 {
+		buffer.WriteString(" and (")
+		buffer.WriteString(strings.Join(hosts, " or "))
+		buffer.WriteString(")")
+	}
+	buffer.WriteString("))")
+	filter := buffer.String()
+	log.WithField("filter", filter).Debug("constructed filter")
+
+	return filter
+}
+
+// handle decodes and logs a packet captured on the interface. Fragments are
+// reassembled, packets that can not be decoded are skipped and counted.
+func (p *pipeline) handle(iface string, raw gopacket.Packet) {
+	if errorLayer := raw.ErrorLayer(); errorLayer != nil {
+		p.skip(log.WithField("interface", iface), "decode error", errorLayer.Error())
+		return
+	}
+
+	raw, err := p.defrag.Defrag(raw)
+	if err != nil {
+		p.skip(log.WithField("interface", iface), "defragmentation error", err)
+		return
+	}
+	if raw == nil {
+		// waiting for the other fragments
+		return
+	}
+
+	p.sequence++
+	record, err := capture.NewRecord(p.sequence, iface, raw)
+	if err != nil {
+		p.skip(log.WithFields(record.Fields()), "decode record failed", err)
+		return
+	}
+	endpoint, ok := p.endpoint(record)
+	if !ok {
+		// reassembled fragments of other traffic
+		p.skipped["other endpoint"]++
+		log.WithFields(record.Fields()).Debug("skipped packet of other endpoint")
+		return
+	}
+	record.Endpoint = endpoint.name
+
+	p.handleRecord(record)
+}
+
+// skip counts and logs a skipped packet.
+func (p *pipeline) skip(ctx log.Interface, reason string, err error) {
+	p.skipped[reason]++
+	ctx = ctx.WithFields(log.Fields{
+		"reason":  reason,
+		"skipped": p.skipped[reason],
+	})
+	if err != nil {
+		ctx = ctx.WithError(err)
+	}
+	ctx.Warn("skipped packet")
+}
+
+// handleDatagram decodes and logs a relayed, received or sent UDP datagram.
+// The datagram is only decoded when the sender did not decode it already.
+func (p *pipeline) handleDatagram(iface string, d datagram) {
+	p.sequence++
+	record := &capture.Record{
+		Sequence:        p.sequence,
+		Timestamp:       d.time,
+		Interface:       iface,
+		Length:          len(d.data),
+		SourceIP:        d.src.IP,
+		SourcePort:      uint16(d.src.Port),
+		DestinationIP:   d.dst.IP,
+		DestinationPort: uint16(d.dst.Port),
+		Payload:         d.data,
+	}
+
+	if d.packet == nil && d.err == nil {
+		p.handleRecord(record)
+		return
+	}
+	p.handlePacket(record, d.packet, d.err)
+}
+
+// handleRecord decodes and logs the packet in the record.
+func (p *pipeline) handleRecord(record *capture.Record) {
+	packet, err := protocol.HandlePacket(record.Payload)
+	p.handlePacket(record, packet, err)
+}
+
+// handlePacket logs the decoded packet of the record, or the error when it
+// could not be decoded. The packet is matched with its request or
+// acknowledgement, updates the state of its gateway and downlinks are added
+// to the duty cycle monitor. Every log contains the capture record of the
+// packet.
+func (p *pipeline) handlePacket(record *capture.Record, packet protocol.Packet, err error) {
+	ctx := log.WithFields(record.Fields())
+
+	if err != nil {
+		class := errorClass(err)
+		p.failures[class]++
+		ctx.WithFields(log.Fields{
+			"data":        record.Payload,
+			"error class": class,
+			"failures":    p.failures[class],
+		}).WithError(err).Error("protocol error")
+		return
+	}
+
+	addr := gatewayEndpoint(record, packet)
+
+	logGatewayEvents(ctx, p.gateways.Update(addr, record.Timestamp, packet))
+
+	packetCtx := ctx
+	if e, ok := p.correlator.Add(addr, record.Timestamp, packet); ok {
+		packetCtx = packetCtx.WithFields(log.Fields{
+			"request": e.Request,
+			"latency": e.Latency,
+		})
+		if pullResp, ok := e.Packet.(*protocol.PullRespPacket); ok {
+			packetCtx = packetCtx.WithFields(pullResp.DownlinkFields())
+		}
+	}
+
+	// attribute downlinks to the gateway that polls from the endpoint
+	name := addr
+	if packet.Type() == protocol.PullResp {
+		if eui, ok := p.gateways.GatewayAt(addr); ok {
+			name = fmt.Sprintf("%X", eui)
+			packetCtx = packetCtx.WithField("gateway mac", name)
+		}
+	}
+	if p.annotator != nil {
+		p.annotator.Annotate(packet)
+	}
+	if p.decrypter != nil {
+		p.decrypter.Decrypt(packet)
+	}
+	packet.Log(packetCtx)
+
+	if txAck, ok := packet.(*protocol.TXAckPacket); ok {
+		p.countTXAck(txAck)
+	}
+
+	if pullResp, ok := packet.(*protocol.PullRespPacket); ok && p.dutyCycle != nil {
+		logDutyCycle(ctx, p.dutyCycle, name, record.Timestamp, &pullResp.Payload.TXPK)
+	}
+
+	if p.loraTap != nil {
+		p.exportLoRaTap(ctx, record.Timestamp, packet)
+	}
+}
+
+// handleLoRaTap decodes and logs a captured LoRaTap frame, the frame is
+// logged as a received packet.
+func (p *pipeline) handleLoRaTap(file string, ci gopacket.CaptureInfo, data []byte) {
+	p.sequence++
+	record := &capture.Record{
+		Sequence:  p.sequence,
+		Timestamp: ci.Timestamp,
+		Interface: file,
+		Length:    ci.Length,
+		Payload:   data,
+	}
+	ctx := log.WithFields(record.Fields())
+
+	var frame loratap.Frame
+	err := frame.UnmarshalBinary(data)
+	if err != nil {
+		ctx.WithField("data", data).WithError(err).Error("loratap error")
+		return
+	}
+
+	rxpk, err := frame.RXPK(ci.Timestamp)
+	if err != nil {
+		ctx.WithError(err).Error("loratap error")
+		return
+	}
+	if p.annotator != nil {
+		p.annotator.AnnotateRXPK(rxpk)
+	}
+	if p.decrypter != nil {
+		p.decrypter.DecryptRXPK(rxpk)
+	}
+	ctx.WithFields(rxpk.Fields()).Info("LoRaTap")
+}
+
+// exportLoRaTap writes the LoRa packets of a PUSH_DATA or PULL_RESP as
+// LoRaTap frames, other packets (eg. FSK) are skipped.
+func (p *pipeline) exportLoRaTap(ctx log.Interface, t time.Time, packet protocol.Packet) {
+	switch packet := packet.(type) {
+	case *protocol.PushDataPacket:
+		for i := range packet.Payload.RXPK {
+			f, err := loratap.NewRXFrame(&packet.Payload.RXPK[i])
+			p.writeLoRaTap(ctx, t, f, err)
+		}
+	case *protocol.PullRespPacket:
+		f, err := loratap.NewTXFrame(&packet.Payload.TXPK)
+		p.writeLoRaTap(ctx, t, f, err)
+	}
+}
+
+// writeLoRaTap writes the frame unless it could not be created.
+func (p *pipeline) writeLoRaTap(ctx log.Interface, t time.Time, f loratap.Frame, err error) {
+	if err != nil {
+		ctx.WithError(err).Debug("loratap export skipped")
+		return
+	}
+
+	err = p.loraTap.WriteFrame(t, f)
+	if err != nil {
+		ctx.WithError(err).Error("loratap export failed")
+	}
+}
+
+// countTXAck counts the status of the TX_ACK for its gateway.
+func (p *pipeline) countTXAck(txAck *protocol.TXAckPacket) {
+	gateway := fmt.Sprintf("%X", txAck.GatewayMac)
+	outcomes, ok := p.txAcks[gateway]
+	if !ok {
+		outcomes = make(map[string]uint64)
+		p.txAcks[gateway] = outcomes
+	}
+	outcomes[txAck.Payload.TXPKACK.ErrorString()]++
+}
+
+// logStats logs the number of handled packets, the skipped packets by
+// reason, the decode failures by error class and the TX_ACK statuses of
+// every gateway.
+func (p *pipeline) logStats() {
+	log.WithFields(log.Fields{
+		"packets":         p.sequence,
+		"skipped":         p.skipped,
+		"decode failures": p.failures,
+	}).Info("pipeline stats")
+
+	gateways := make([]string, 0, len(p.txAcks))
+	for gateway := range p.txAcks {
+		gateways = append(gateways, gateway)
+	}
+	sort.Strings(gateways)
+	for _, gateway := range gateways {
+		log.WithFields(log.Fields{
+			"gateway mac": gateway,
+			"outcomes":    p.txAcks[gateway],
+		}).Info("tx ack outcomes")
+	}
+}
+
+// errorClass returns the class of a protocol error: the kind of the
+// underlying error for encoding errors, otherwise its message without the
+// details.
+func errorClass(err error) string {
+	switch cause := errors.Cause(err).(type) {
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return "invalid json"
+	case base64.CorruptInputError:
+		return "invalid base64"
+	default:
+		class := cause.Error()
+		if i := strings.Index(class, ":"); i >= 0 {
+			class = class[:i]
+		}
+		return class
+	}
+}
+
+// expire logs the missing acknowledgements and silent gateways at the given
+// time.
+func (p *pipeline) expire(t time.Time) {
+	logMissingACKs(p.correlator, t)
+	logGatewayEvents(log.Log, p.gateways.Expire(t))
+	if p.dutyCycle != nil {
+		p.dutyCycle.Expire(t)
+	}
+}
+
+// logMissingACKs logs the requests that were not acknowledged in time.
+func logMissingACKs(correlator *protocol.Correlator, t time.Time) {
+	for _, e := range correlator.Expire(t) {
+		log.WithFields(log.Fields{
+			"gateway":      e.Gateway,
+			"random token": e.Token,
+			"request":      e.Request,
+			"sent":         e.Sent,
+		}).Warn("missing ACK")
+	}
+}
+
+// logGatewayEvents logs the changes in the state of the gateways.
+func logGatewayEvents(ctx log.Interface, events []protocol.GatewayEvent) {
+	for _, e := range events {
+		ctx := ctx.WithFields(e.Fields())
+		switch e.Type {
+		case protocol.GatewayNew, protocol.GatewayResumed:
+			ctx.Info(e.Type.String())
+		default:
+			ctx.Warn(e.Type.String())
+		}
+	}
+}
+
+// gatewayEndpoint returns the UDP endpoint of the gateway that sent or
+// receives the packet.
+func gatewayEndpoint(record *capture.Record, packet protocol.Packet) string {
+	if packet.Direction() == protocol.Downlink {
+		return record.Destination()
+	}
+	return record.Source()
+}
+
+// logDutyCycle adds the transmission to the duty cycle monitor and logs the
+// utilisation of the sub-band, a warning is logged when the gateway exceeds
+// the duty cycle limit.
+func logDutyCycle(ctx log.Interface, monitor *region.DutyCycleMonitor, gateway string, t time.Time, txpk *protocol.TXPK) {
+	airtime, err := txpk.Airtime()
+	if err != nil {
+		ctx.WithError(err).Debug("duty cycle: unknown airtime")
+		return
+	}
+
+	u, ok := monitor.Add(gateway, t, region.Hz(txpk.Freq), airtime)
+	if !ok {
+		return
+	}
+
+	ctx = ctx.WithFields(log.Fields{
+		"gateway":              u.Gateway,
+		"sub-band":             u.SubBand.Name,
+		"airtime in window":    u.Airtime,
+		"duty cycle (%)":       u.DutyCycle * 100,
+		"duty cycle limit (%)": u.SubBand.DutyCycle * 100,
+	})
+	if u.OverLimit() {
+		ctx.Warn("duty cycle: limit exceeded")
+	} else {
+		ctx.Info("duty cycle")
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/bullettime/lora-logger/protocol"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// proxyIdleTimeout is the time after which the upstream socket of a gateway
+// is closed when the server sent nothing on it. It is opened again with the
+// next datagram of the gateway.
+const proxyIdleTimeout = 5 * time.Minute
+
+// proxyQueueSize is the number of relayed datagrams that may wait to be
+// logged, the relaying never waits for the logging.
+const proxyQueueSize = 1024
+
+// defaultServerPort is the port of the network server when none is
+// configured.
+const defaultServerPort = 1700
+
+// proxyBufferSize is larger than any packet of the Semtech UDP protocol.
+const proxyBufferSize = 65535
+
+// proxyCmd represents the proxy command
+var proxyCmd = &cobra.Command{
+	Use:   "proxy",
+	Short: "Relay and log the packet forwarder traffic",
+	Long: `lora-logger proxy listens on the configured port for the traffic of the packet
+forwarders and relays it in both directions to the network server, logging every
+packet the same way as lora-logger start. The packet forwarder must be configured to
+use lora-logger as its server. No packet capture privileges or libpcap are needed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			port   = viper.GetInt("port")
+			server = viper.GetString("proxy_server")
+		)
+		if port == 0 {
+			port = defaultServerPort
+		}
+		if len(server) == 0 {
+			server = net.JoinHostPort(viper.GetString("host"), strconv.Itoa(port))
+		}
+		log.WithFields(log.Fields{
+			"port":   port,
+			"server": server,
+		}).Debug("loaded settings")
+
+		pipeline := loadPipeline()
+		defer pipeline.close()
+
+		serverAddr, err := net.ResolveUDPAddr("udp", server)
+		if err != nil || serverAddr.IP == nil {
+			log.WithError(err).WithField("server", server).Fatal("resolve server failed")
+		}
+
+		listener, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+		if err != nil {
+			log.WithError(err).Fatal("listen failed")
+		}
+		defer listener.Close()
+
+		p := &proxy{
+			listener:  listener,
+			server:    serverAddr,
+			upstreams: make(map[string]*net.UDPConn),
+			datagrams: make(chan datagram, proxyQueueSize),
+		}
+		go p.listen()
+
+		// Handle the relayed datagrams one by one
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		statsC, stopStats := statsTicks()
+		defer stopStats()
+		for {
+			select {
+			case d := <-p.datagrams:
+				pipeline.handleDatagram("proxy", d)
+			case t := <-ticker.C:
+				pipeline.expire(t)
+			case <-statsC:
+				pipeline.logStats()
+			}
+		}
+	},
+}
+
+// datagram is a relayed, received or sent UDP datagram. The packet and err
+// are the result of decoding the data when the sender decoded it already.
+type datagram struct {
+	time   time.Time
+	src    *net.UDPAddr
+	dst    *net.UDPAddr
+	data   []byte
+	packet protocol.Packet
+	err    error
+}
+
+// proxy relays the datagrams of every gateway to the server over a socket
+// per gateway, so the replies of the server can be sent back to the right
+// gateway.
+type proxy struct {
+	sync.Mutex
+	listener  *net.UDPConn
+	server    *net.UDPAddr
+	upstreams map[string]*net.UDPConn
+	datagrams chan datagram
+}
+
+// listen relays the datagrams of the gateways to the server.
+func (p *proxy) listen() {
+	for {
+		buffer := make([]byte, proxyBufferSize)
+		n, gateway, err := p.listener.ReadFromUDP(buffer)
+		if err != nil {
+			log.WithError(err).Fatal("read from gateway failed")
+		}
+		data := buffer[:n]
+		t := time.Now()
+
+		err = p.relay(gateway, data)
+		if err != nil {
+			log.WithError(err).WithField("gateway", gateway.String()).Error("relay to server failed")
+			continue
+		}
+
+		queueDatagram(p.datagrams, datagram{time: t, src: gateway, dst: p.server, data: data})
+	}
+}
+
+// relay sends the datagram of the gateway to the server. When the upstream
+// socket was closed in the meantime, it is opened again.
+func (p *proxy) relay(gateway *net.UDPAddr, data []byte) error {
+	upstream, err := p.upstream(gateway)
+	if err != nil {
+		return err
+	}
+
+	_, err = upstream.Write(data)
+	if err == nil {
+		return nil
+	}
+
+	p.closeUpstream(gateway, upstream)
+	upstream, err = p.upstream(gateway)
+	if err != nil {
+		return err
+	}
+	_, err = upstream.Write(data)
+	return err
+}
+
+// upstream returns the socket to the server of the gateway, it is created
+// when the gateway is new.
+func (p *proxy) upstream(gateway *net.UDPAddr) (*net.UDPConn, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	upstream, ok := p.upstreams[gateway.String()]
+	if ok {
+		return upstream, nil
+	}
+
+	upstream, err := net.DialUDP("udp", nil, p.server)
+	if err != nil {
+		return nil, err
+	}
+	p.upstreams[gateway.String()] = upstream
+	go p.relayReplies(gateway, upstream)
+
+	return upstream, nil
+}
+
+// closeUpstream closes the upstream socket of the gateway and removes it,
+// unless it was replaced already.
+func (p *proxy) closeUpstream(gateway *net.UDPAddr, upstream *net.UDPConn) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.upstreams[gateway.String()] == upstream {
+		delete(p.upstreams, gateway.String())
+	}
+	upstream.Close()
+}
+
+// isUpstream returns whether the socket is the upstream socket of the
+// gateway.
+func (p *proxy) isUpstream(gateway *net.UDPAddr, upstream *net.UDPConn) bool {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.upstreams[gateway.String()] == upstream
+}
+
+// relayReplies relays the datagrams of the server back to the gateway, until
+// the server is silent for the idle timeout or the socket is closed.
+func (p *proxy) relayReplies(gateway *net.UDPAddr, upstream *net.UDPConn) {
+	defer p.closeUpstream(gateway, upstream)
+
+	for {
+		upstream.SetReadDeadline(time.Now().Add(proxyIdleTimeout))
+
+		buffer := make([]byte, proxyBufferSize)
+		n, err := upstream.Read(buffer)
+		if err != nil {
+			// a socket closed by a failed relay is not an error
+			if e, ok := err.(net.Error); (!ok || !e.Timeout()) && p.isUpstream(gateway, upstream) {
+				log.WithError(err).WithField("gateway", gateway.String()).Error("read from server failed")
+			}
+			return
+		}
+		data := buffer[:n]
+		t := time.Now()
+
+		_, err = p.listener.WriteToUDP(data, gateway)
+		if err != nil {
+			log.WithError(err).WithField("gateway", gateway.String()).Error("relay to gateway failed")
+		}
+
+		queueDatagram(p.datagrams, datagram{time: t, src: p.server, dst: gateway, data: data})
+	}
+}
+
+// queueDatagram queues the relayed datagram to be logged. When the logging
+// can not keep up, the datagram is dropped from the log rather than delaying
+// the traffic.
+func queueDatagram(datagrams chan<- datagram, d datagram) {
+	select {
+	case datagrams <- d:
+	default:
+		log.WithFields(log.Fields{
+			"source":      d.src.String(),
+			"destination": d.dst.String(),
+		}).Warn("log queue full, datagram not logged")
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(proxyCmd)
+}
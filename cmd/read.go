@@ -0,0 +1,110 @@
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build !nopcap
+// +build !nopcap
+
+package cmd
+
+import (
+	"io"
+
+	"github.com/apex/log"
+	"github.com/bullettime/lora-logger/loratap"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcap"
+	"github.com/spf13/cobra"
+)
+
+// readCmd represents the read command
+var readCmd = &cobra.Command{
+	Use:   "read <file.pcap>",
+	Short: "Log the traffic in a capture file",
+	Long: `lora-logger read filters the traffic in a pcap or pcapng capture file (eg. made with
+tcpdump) with the predefined settings (or default) and logs it the same way as
+lora-logger start. The timestamps of the captured packets are used instead of
+the current time.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		file := args[0]
+		log.WithField("file", file).Debug("loaded settings")
+
+		pipeline := loadPipeline()
+		defer pipeline.close()
+
+		// Read LoRaTap captures (eg. from SDR receivers) frame by frame
+		reader, err := loratap.Open(file)
+		switch err {
+		case nil:
+			defer reader.Close()
+			readLoRaTap(pipeline, file, reader)
+		case loratap.ErrNotLoRaTap:
+			readPcap(pipeline, file)
+		default:
+			log.WithError(err).Fatal("open file failed")
+		}
+		pipeline.logStats()
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(readCmd)
+}
+
+// readLoRaTap handles every frame of the LoRaTap capture, time advances with
+// the timestamps of the frames.
+func readLoRaTap(p *pipeline, file string, reader *loratap.Reader) {
+	for {
+		data, ci, err := reader.ReadPacketData()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.WithError(err).Fatal("read loratap file failed")
+		}
+		p.expire(ci.Timestamp)
+		p.handleLoRaTap(file, ci, data)
+	}
+}
+
+// readPcap handles every packet of the capture that matches the filter of
+// the pipeline.
+func readPcap(p *pipeline, file string) {
+	// Open file
+	handle, err := pcap.OpenOffline(file)
+	if err != nil {
+		log.WithError(err).Fatal("open file failed")
+	}
+	defer handle.Close()
+
+	// Set filter
+	err = handle.SetBPFFilter(p.filter())
+	if err != nil {
+		log.WithError(err).Fatal("filter failed")
+	}
+
+	// Use the handle as a packet source to process all packets, time
+	// advances with the timestamps of the packets
+	packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
+	for raw := range packetSource.Packets() {
+		p.expire(raw.Metadata().Timestamp)
+		p.handle(file, raw)
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/bullettime/lora-logger/lorawan"
+	"github.com/bullettime/lora-logger/protocol"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Answer and log the packet forwarders as a network server",
+	Long: `lora-logger serve acts as a minimal network server on the configured port. It
+acknowledges the PUSH_DATA and PULL_DATA packets of the packet forwarders and sends
+the queued downlinks, loaded from a file or posted to the local API, as PULL_RESP
+packets. Every packet is logged the same way as lora-logger start.
+
+Downlinks are JSON objects with the gateway and the txpk of the packet forwarder
+protocol, eg. {"gateway": "0102030405060708", "txpk": {"imme": true, ...}}. The file
+contains an array of downlinks, the API accepts a downlink on POST /downlinks. The
+API is not authenticated, it listens on localhost unless a host is configured.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			port      = viper.GetInt("port")
+			downlinks = viper.GetString("serve_downlinks")
+			api       = viper.GetString("serve_api")
+		)
+		if port == 0 {
+			port = defaultServerPort
+		}
+		log.WithFields(log.Fields{
+			"port":      port,
+			"downlinks": downlinks,
+			"api":       api,
+		}).Debug("loaded settings")
+
+		pipeline := loadPipeline()
+		defer pipeline.close()
+
+		listener, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+		if err != nil {
+			log.WithError(err).Fatal("listen failed")
+		}
+		defer listener.Close()
+
+		s := &server{
+			conn:      listener,
+			gateways:  make(map[[8]byte]servedGateway),
+			queue:     make(map[[8]byte][]protocol.TXPK),
+			datagrams: make(chan datagram, proxyQueueSize),
+		}
+
+		// Queue downlinks
+		if len(downlinks) > 0 {
+			err = s.load(downlinks)
+			if err != nil {
+				log.WithError(err).Fatal("load downlinks failed")
+			}
+		}
+		if len(api) > 0 {
+			go s.serveAPI(api)
+		}
+
+		go s.listen()
+
+		// Handle the received and sent datagrams one by one
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		statsC, stopStats := statsTicks()
+		defer stopStats()
+		for {
+			select {
+			case d := <-s.datagrams:
+				pipeline.handleDatagram("serve", d)
+			case t := <-ticker.C:
+				pipeline.expire(t)
+			case <-statsC:
+				pipeline.logStats()
+			}
+		}
+	},
+}
+
+// downlink is a PULL_RESP to be sent to a gateway.
+type downlink struct {
+	Gateway lorawan.EUI64 `json:"gateway"`
+	TXPK    protocol.TXPK `json:"txpk"`
+}
+
+// servedGateway is the endpoint a gateway polls from.
+type servedGateway struct {
+	addr     *net.UDPAddr
+	protocol uint8
+}
+
+// server answers the packet forwarders and sends the queued downlinks to
+// the gateways that poll for them.
+type server struct {
+	sync.Mutex
+	conn      *net.UDPConn
+	gateways  map[[8]byte]servedGateway
+	queue     map[[8]byte][]protocol.TXPK
+	datagrams chan datagram
+}
+
+// listen answers the packets of the packet forwarders.
+func (s *server) listen() {
+	for {
+		buffer := make([]byte, proxyBufferSize)
+		n, addr, err := s.conn.ReadFromUDP(buffer)
+		if err != nil {
+			log.WithError(err).Fatal("read from gateway failed")
+		}
+		data := buffer[:n]
+		t := time.Now()
+
+		// Errors are logged by the pipeline
+		packet, err := protocol.HandlePacket(data)
+		received := datagram{time: t, src: addr, dst: s.localAddr(), data: data, packet: packet, err: err}
+
+		// Acknowledge before anything is logged
+		var ack protocol.Packet
+		switch packet := packet.(type) {
+		case *protocol.PushDataPacket:
+			ack = &protocol.PushAckPacket{
+				Protocol:    packet.Protocol,
+				RandomToken: packet.RandomToken,
+			}
+		case *protocol.PullDataPacket:
+			ack = &protocol.PullAckPacket{
+				Protocol:    packet.Protocol,
+				RandomToken: packet.RandomToken,
+			}
+		}
+		var sent *datagram
+		if ack != nil {
+			sent = s.write(addr, ack)
+		}
+		queueDatagram(s.datagrams, received)
+		if sent != nil {
+			queueDatagram(s.datagrams, *sent)
+		}
+
+		if packet, ok := packet.(*protocol.PullDataPacket); ok {
+			s.Lock()
+			s.gateways[packet.GatewayMac] = servedGateway{addr, packet.Protocol}
+			s.Unlock()
+			s.flush(packet.GatewayMac)
+		}
+	}
+}
+
+// localAddr returns the address the server listens on.
+func (s *server) localAddr() *net.UDPAddr {
+	addr, _ := s.conn.LocalAddr().(*net.UDPAddr)
+	return addr
+}
+
+// send sends the packet to the gateway and queues it to be logged.
+func (s *server) send(addr *net.UDPAddr, packet protocol.Packet) {
+	if sent := s.write(addr, packet); sent != nil {
+		queueDatagram(s.datagrams, *sent)
+	}
+}
+
+// write sends the packet to the gateway, it returns the datagram that was
+// sent or nil when it failed.
+func (s *server) write(addr *net.UDPAddr, packet protocol.Packet) *datagram {
+	data, err := packet.MarshalBinary()
+	if err != nil {
+		log.WithError(err).WithField("type", packet.Type()).Error("encode packet failed")
+		return nil
+	}
+
+	_, err = s.conn.WriteToUDP(data, addr)
+	if err != nil {
+		log.WithError(err).WithField("gateway", addr.String()).Error("send to gateway failed")
+		return nil
+	}
+
+	return &datagram{time: time.Now(), src: s.localAddr(), dst: addr, data: data, packet: packet}
+}
+
+// enqueue queues the downlink and sends it when the gateway is polling.
+func (s *server) enqueue(d downlink) {
+	s.Lock()
+	s.queue[d.Gateway] = append(s.queue[d.Gateway], d.TXPK)
+	s.Unlock()
+
+	s.flush(d.Gateway)
+}
+
+// flush sends the queued downlinks of the gateway, when its endpoint is
+// known.
+func (s *server) flush(eui [8]byte) {
+	s.Lock()
+	gateway, ok := s.gateways[eui]
+	queue := s.queue[eui]
+	if ok {
+		delete(s.queue, eui)
+	}
+	s.Unlock()
+
+	if !ok {
+		return
+	}
+
+	for _, txpk := range queue {
+		s.send(gateway.addr, &protocol.PullRespPacket{
+			Protocol:    gateway.protocol,
+			RandomToken: uint16(rand.Intn(1 << 16)),
+			Payload:     protocol.PullRespPayload{TXPK: txpk},
+		})
+	}
+}
+
+// load queues the downlinks in the JSON file.
+func (s *server) load(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "load failed")
+	}
+
+	var downlinks []downlink
+	err = json.Unmarshal(data, &downlinks)
+	if err != nil {
+		return errors.Wrap(err, "load failed")
+	}
+
+	for _, d := range downlinks {
+		s.enqueue(d)
+	}
+	log.WithField("downlinks", len(downlinks)).Debug("queued downlinks")
+
+	return nil
+}
+
+// serveAPI accepts downlinks on POST /downlinks. Without host in the
+// address, the API only listens on localhost.
+func (s *server) serveAPI(addr string) {
+	if host, port, err := net.SplitHostPort(addr); err == nil && len(host) == 0 {
+		addr = net.JoinHostPort("localhost", port)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/downlinks", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var d downlink
+		err := json.NewDecoder(r.Body).Decode(&d)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.enqueue(d)
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	log.WithField("address", addr).Debug("serving downlink api")
+	err := http.ListenAndServe(addr, mux)
+	log.WithError(err).Fatal("downlink api failed")
+}
+
+func init() {
+	RootCmd.AddCommand(serveCmd)
+}
@@ -18,21 +18,26 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
+//go:build !nopcap
+// +build !nopcap
+
 package cmd
 
 import (
-	"bytes"
-	"strconv"
 	"time"
 
 	"github.com/apex/log"
-	"github.com/bullettime/lora-logger/protocol"
+	"github.com/bullettime/lora-logger/capture"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/pcap"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+// mergeWindow is how long packets are held to merge the packets of the
+// devices in capture order.
+const mergeWindow = 100 * time.Millisecond
+
 // startCmd represents the start command
 var startCmd = &cobra.Command{
 	Use:   "start",
@@ -41,62 +46,106 @@ var startCmd = &cobra.Command{
 from the active packet forwarder and logs this traffic to a log file and/or standard output.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		var (
-			device            = viper.GetString("device")
-			host              = viper.GetString("host")
-			port              = viper.GetInt("port")
-			snapshotLen int32 = 65535
-			promiscuous       = viper.GetBool("promiscuous")
-			timeout           = time.Duration(viper.GetInt("timeout")) * time.Second
-			handle      *pcap.Handle
+			devices             = viper.GetStringSlice("devices")
+			snapshotLen   int32 = 65535
+			promiscuous         = viper.GetBool("promiscuous")
+			timeout             = time.Duration(viper.GetInt("timeout")) * time.Second
+			pcapPrefix          = viper.GetString("pcap_prefix")
+			pcapMaxSize         = int64(viper.GetInt("pcap_max_size")) << 20
+			pcapMaxAge          = time.Duration(viper.GetInt("pcap_max_age")) * time.Second
+			pcapRetention       = viper.GetInt("pcap_retention")
+			statsInterval       = time.Duration(viper.GetInt("stats_interval")) * time.Second
 		)
+		if len(devices) == 0 {
+			devices = []string{viper.GetString("device")}
+		}
 		log.WithFields(log.Fields{
-			"device":      device,
-			"host":        host,
-			"port":        port,
-			"promiscuous": promiscuous,
-			"timeout":     timeout,
+			"devices":        devices,
+			"promiscuous":    promiscuous,
+			"timeout":        timeout,
+			"pcap prefix":    pcapPrefix,
+			"pcap max size":  pcapMaxSize,
+			"pcap max age":   pcapMaxAge,
+			"pcap retention": pcapRetention,
+			"stats interval": statsInterval,
 		}).Debug("loaded settings")
 
-		// Open device
-		handle, err := pcap.OpenLive(device, snapshotLen, promiscuous, timeout)
-		if err != nil {
-			log.WithError(err).Fatal("open device failed")
-		}
-		defer handle.Close()
-
-		// Set filter
-		var buffer bytes.Buffer
-		buffer.WriteString("udp")
-		if len(host) > 0 {
-			buffer.WriteString(" and host ")
-			buffer.WriteString(host)
-		}
-		if port != 0 {
-			buffer.WriteString(" and port ")
-			buffer.WriteString(strconv.Itoa(port))
-		}
-		filter := buffer.String()
-		log.WithField("filter", filter).Debug("constructed filter")
-		err = handle.SetBPFFilter(filter)
-		if err != nil {
-			log.WithError(err).Fatal("filter failed")
-		}
+		pipeline := loadPipeline()
+		defer pipeline.close()
+		bpfFilter := pipeline.filter()
+
+		stats := newCaptureStats()
+		sources := make([]capture.Source, 0, len(devices))
+		for _, device := range devices {
+			ctx := log.WithField("device", device)
+
+			// Open device
+			handle, err := pcap.OpenLive(device, snapshotLen, promiscuous, timeout)
+			if err != nil {
+				ctx.WithError(err).Fatal("open device failed")
+			}
+			defer handle.Close()
+			stats.add(device, handle)
 
-		// Use the handle as a packet source to process all packets
-		packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
-		for packet := range packetSource.Packets() {
-			data := packet.TransportLayer().LayerPayload()
-			packet, err := protocol.HandlePacket(data)
+			// Set filter
+			err = handle.SetBPFFilter(bpfFilter)
 			if err != nil {
-				ctx := log.WithField("data", data)
-				ctx.WithError(err).Error("protocol error")
-			} else {
-				packet.Log(log.Log)
+				ctx.WithError(err).Fatal("filter failed")
 			}
 
-			//switch p := packet.(type) {
-			//case protocol.PushDataPacket:
-			//}
+			// Write the filtered packets to pcapng files, one set of files
+			// per device
+			var tee *capture.Tee
+			if len(pcapPrefix) > 0 {
+				prefix := pcapPrefix
+				if len(devices) > 1 {
+					prefix += "-" + device
+				}
+				tee = capture.NewTee(prefix, device, bpfFilter, handle.LinkType(), pcapMaxSize, pcapMaxAge, pcapRetention)
+				defer tee.Close()
+			}
+
+			// Use the handle as a packet source, tee the packets as they
+			// are captured
+			packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
+			packets := make(chan gopacket.Packet)
+			go func(ctx log.Interface, tee *capture.Tee) {
+				defer close(packets)
+				for raw := range packetSource.Packets() {
+					if tee != nil {
+						err := tee.WritePacket(raw.Metadata().CaptureInfo, raw.Data())
+						if err != nil {
+							ctx.WithError(err).Error("pcap tee failed")
+						}
+					}
+					packets <- raw
+				}
+			}(ctx, tee)
+			sources = append(sources, capture.Source{Interface: device, Packets: packets})
+		}
+
+		// Process the packets of all devices in the order they are captured
+		merged := capture.Merge(mergeWindow, sources...)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		// Report the capture statistics and pipeline counters
+		statsC, stopStats := statsTicks()
+		defer stopStats()
+
+		for {
+			select {
+			case packet, ok := <-merged:
+				if !ok {
+					return
+				}
+				pipeline.handle(packet.Interface, packet.Packet)
+			case t := <-ticker.C:
+				pipeline.expire(t)
+			case <-statsC:
+				stats.log()
+				pipeline.logStats()
+			}
 		}
 	},
 }
@@ -116,4 +165,6 @@ func init() {
 	viper.SetDefault("device", "eth0")
 	viper.SetDefault("promiscuous", false)
 	viper.SetDefault("timeout", -1)
+	viper.SetDefault("pcap_max_size", 100)
+	viper.SetDefault("pcap_max_age", 3600)
 }
@@ -0,0 +1,79 @@
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build !nopcap
+// +build !nopcap
+
+package cmd
+
+import (
+	"github.com/apex/log"
+	"github.com/google/gopacket/pcap"
+)
+
+// captureStats reports the statistics of the capture handles of the
+// devices.
+type captureStats struct {
+	devices []string
+	handles map[string]*pcap.Handle
+	last    map[string]pcap.Stats
+}
+
+// newCaptureStats returns empty capture statistics.
+func newCaptureStats() *captureStats {
+	return &captureStats{
+		handles: make(map[string]*pcap.Handle),
+		last:    make(map[string]pcap.Stats),
+	}
+}
+
+// add adds the capture handle of the device.
+func (s *captureStats) add(device string, handle *pcap.Handle) {
+	s.devices = append(s.devices, device)
+	s.handles[device] = handle
+}
+
+// log logs the statistics of every device, with a warning when packets were
+// dropped since the previous report.
+func (s *captureStats) log() {
+	for _, device := range s.devices {
+		ctx := log.WithField("device", device)
+
+		stats, err := s.handles[device].Stats()
+		if err != nil {
+			ctx.WithError(err).Error("capture stats failed")
+			continue
+		}
+		last := s.last[device]
+		s.last[device] = *stats
+
+		ctx = ctx.WithFields(log.Fields{
+			"packets received":  stats.PacketsReceived,
+			"packets dropped":   stats.PacketsDropped,
+			"interface dropped": stats.PacketsIfDropped,
+		})
+		dropped := stats.PacketsDropped - last.PacketsDropped + stats.PacketsIfDropped - last.PacketsIfDropped
+		if dropped > 0 {
+			ctx.WithField("dropped since last", dropped).Warn("capture dropped packets")
+			continue
+		}
+		ctx.Info("capture stats")
+	}
+}
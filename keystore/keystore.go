@@ -0,0 +1,170 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package keystore loads the keys of the end-devices that are needed to
+// decrypt and verify their frames.
+package keystore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/bullettime/lora-logger/lorawan"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Device contains the keys of an end-device. The AppKey (and NwkKey for
+// LoRaWAN 1.1) is used for the join procedure, the session keys for the
+// frames of an active session. LoRaWAN 1.0.x devices use the NwkSKey, 1.1
+// devices the FNwkSIntKey, SNwkSIntKey and NwkSEncKey instead.
+type Device struct {
+	MACVersion  lorawan.MACVersion `yaml:"mac_version"`
+	DevEUI      lorawan.EUI64      `yaml:"dev_eui"`
+	AppKey      lorawan.AES128Key  `yaml:"app_key"`
+	NwkKey      lorawan.AES128Key  `yaml:"nwk_key"`
+	DevAddr     lorawan.DevAddr    `yaml:"dev_addr"`
+	NwkSKey     lorawan.AES128Key  `yaml:"nwk_s_key"`
+	FNwkSIntKey lorawan.AES128Key  `yaml:"f_nwk_s_int_key"`
+	SNwkSIntKey lorawan.AES128Key  `yaml:"s_nwk_s_int_key"`
+	NwkSEncKey  lorawan.AES128Key  `yaml:"nwk_s_enc_key"`
+	AppSKey     lorawan.AES128Key  `yaml:"app_s_key"`
+}
+
+// HasSession returns true when the session keys of the device are
+// configured.
+func (d Device) HasSession() bool {
+	return d.SessionKeys().FNwkSIntKey != lorawan.AES128Key{}
+}
+
+// SessionKeys returns the session keys of the device.
+func (d Device) SessionKeys() lorawan.SessionKeys {
+	if d.MACVersion == lorawan.LoRaWAN1_1 {
+		return lorawan.SessionKeys{
+			FNwkSIntKey: d.FNwkSIntKey,
+			SNwkSIntKey: d.SNwkSIntKey,
+			NwkSEncKey:  d.NwkSEncKey,
+			AppSKey:     d.AppSKey,
+		}
+	}
+
+	return lorawan.SessionKeys{
+		FNwkSIntKey: d.NwkSKey,
+		SNwkSIntKey: d.NwkSKey,
+		NwkSEncKey:  d.NwkSKey,
+		AppSKey:     d.AppSKey,
+	}
+}
+
+// JoinKey returns the root key that signs the join-request, the AppKey for
+// LoRaWAN 1.0.x and the NwkKey for 1.1.
+func (d Device) JoinKey() lorawan.AES128Key {
+	if d.MACVersion == lorawan.LoRaWAN1_1 {
+		return d.NwkKey
+	}
+	return d.AppKey
+}
+
+type yamlStore struct {
+	Devices []Device `yaml:"devices"`
+}
+
+// Store contains the keys of the configured end-devices.
+type Store struct {
+	devices []Device
+}
+
+// Load reads the devices from a yaml file, or from all yaml files in a
+// directory.
+func Load(path string) (*Store, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "load key store failed")
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files = nil
+		for _, pattern := range []string{"*.yaml", "*.yml"} {
+			matches, err := filepath.Glob(filepath.Join(path, pattern))
+			if err != nil {
+				return nil, errors.Wrap(err, "load key store failed")
+			}
+			files = append(files, matches...)
+		}
+	}
+
+	var s Store
+	for _, file := range files {
+		err = s.loadFile(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "load key store failed")
+		}
+	}
+
+	return &s, nil
+}
+
+func (s *Store) loadFile(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var y yamlStore
+	err = yaml.Unmarshal(data, &y)
+	if err != nil {
+		return errors.Wrapf(err, "parse %s failed", file)
+	}
+
+	s.devices = append(s.devices, y.Devices...)
+
+	return nil
+}
+
+// Devices returns all configured devices.
+func (s *Store) Devices() []Device {
+	return s.devices
+}
+
+// Device returns the device with the given DevEUI.
+func (s *Store) Device(devEUI lorawan.EUI64) (Device, bool) {
+	for _, device := range s.devices {
+		if device.DevEUI == devEUI {
+			return device, true
+		}
+	}
+	return Device{}, false
+}
+
+// Sessions returns the devices with an active session for the given DevAddr.
+// DevAddrs are not unique, so more than one device can be returned.
+func (s *Store) Sessions(devAddr lorawan.DevAddr) []Device {
+	var devices []Device
+	for _, device := range s.devices {
+		if device.DevAddr == devAddr && device.HasSession() {
+			devices = append(devices, device)
+		}
+	}
+	return devices
+}
@@ -0,0 +1,137 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package keystore
+
+import (
+	"testing"
+
+	"github.com/bullettime/lora-logger/lorawan"
+)
+
+func mustEUI(t *testing.T, s string) lorawan.EUI64 {
+	var eui lorawan.EUI64
+	if err := eui.UnmarshalText([]byte(s)); err != nil {
+		t.Fatalf("invalid test eui %q: %v", s, err)
+	}
+	return eui
+}
+
+func mustKey(t *testing.T, s string) lorawan.AES128Key {
+	var key lorawan.AES128Key
+	if err := key.UnmarshalText([]byte(s)); err != nil {
+		t.Fatalf("invalid test key %q: %v", s, err)
+	}
+	return key
+}
+
+func TestLoadFile(t *testing.T) {
+	s, err := Load("testdata/devices.yaml")
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if n := len(s.Devices()); n != 3 {
+		t.Fatalf("%d devices loaded, expected 3", n)
+	}
+
+	device, ok := s.Device(mustEUI(t, "0004A30B001C0530"))
+	if !ok {
+		t.Fatal("device 0004A30B001C0530 not found")
+	}
+	if device.MACVersion != lorawan.LoRaWAN1_0 || !device.HasSession() {
+		t.Errorf("device %+v, expected a 1.0 session", device)
+	}
+	nwkSKey := mustKey(t, "44024241ED4CE9A68C6A8BC055233FD3")
+	keys := device.SessionKeys()
+	if keys.FNwkSIntKey != nwkSKey || keys.SNwkSIntKey != nwkSKey || keys.NwkSEncKey != nwkSKey {
+		t.Errorf("session keys %+v, expected the NwkSKey for all network keys", keys)
+	}
+	if device.JoinKey() != mustKey(t, "2B7E151628AED2A6ABF7158809CF4F3C") {
+		t.Errorf("join key %s, expected the AppKey", device.JoinKey())
+	}
+
+	device, ok = s.Device(mustEUI(t, "0004A30B001C0531"))
+	if !ok {
+		t.Fatal("device 0004A30B001C0531 not found")
+	}
+	if device.MACVersion != lorawan.LoRaWAN1_1 {
+		t.Errorf("mac version %s, expected 1.1", device.MACVersion)
+	}
+	if keys := device.SessionKeys(); keys.SNwkSIntKey != mustKey(t, "202122232425262728292A2B2C2D2E2F") {
+		t.Errorf("session keys %+v, expected the 1.1 SNwkSIntKey", keys)
+	}
+	if device.JoinKey() != mustKey(t, "000102030405060708090A0B0C0D0E0F") {
+		t.Errorf("join key %s, expected the NwkKey", device.JoinKey())
+	}
+
+	device, ok = s.Device(mustEUI(t, "0004A30B001C0532"))
+	if !ok || device.HasSession() {
+		t.Errorf("device %+v, expected a device without session", device)
+	}
+
+	if _, ok := s.Device(mustEUI(t, "0004A30B001C0533")); ok {
+		t.Error("unknown device found")
+	}
+}
+
+func TestLoadDirectory(t *testing.T) {
+	s, err := Load("testdata/devices")
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if n := len(s.Devices()); n != 2 {
+		t.Fatalf("%d devices loaded, expected 2", n)
+	}
+	for _, eui := range []string{"0004A30B001C0530", "0004A30B001C0531"} {
+		if _, ok := s.Device(mustEUI(t, eui)); !ok {
+			t.Errorf("device %s not found", eui)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, path := range []string{"testdata/missing.yaml", "testdata/invalid.yaml"} {
+		if _, err := Load(path); err == nil {
+			t.Errorf("%s: load succeeded", path)
+		}
+	}
+}
+
+func TestSessions(t *testing.T) {
+	s, err := Load("testdata/devices.yaml")
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	// both session devices share the DevAddr, the third has no session
+	devices := s.Sessions(lorawan.DevAddr{0x49, 0xBE, 0x7D, 0xF1})
+	if len(devices) != 2 {
+		t.Fatalf("%d sessions found, expected 2", len(devices))
+	}
+	if devices[0].DevEUI != mustEUI(t, "0004A30B001C0530") || devices[1].DevEUI != mustEUI(t, "0004A30B001C0531") {
+		t.Errorf("sessions of %s and %s, expected the devices in file order", devices[0].DevEUI, devices[1].DevEUI)
+	}
+
+	if devices := s.Sessions(lorawan.DevAddr{0x01, 0x02, 0x03, 0x04}); len(devices) != 0 {
+		t.Errorf("%d sessions found for an unknown address", len(devices))
+	}
+}
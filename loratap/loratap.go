@@ -0,0 +1,219 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package loratap implements the LoRaTap encapsulation (link type 270) of
+// LoRa frames, as used by Wireshark to dissect LoRaWAN and by SDR receivers
+// to capture LoRa traffic.
+//
+// Specification: https://github.com/eriknl/LoRaTap
+package loratap
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bullettime/lora-logger/protocol"
+	"github.com/pkg/errors"
+)
+
+// LinkType is the pcap link type of LoRaTap. It does not fit in a
+// layers.LinkType, so the pcap file header is handled by this package.
+const LinkType uint32 = 270
+
+// HeaderLength is the length of a version 0 LoRaTap header.
+const HeaderLength = 15
+
+// SyncWordLoRaWAN is the sync word of public LoRaWAN networks.
+const SyncWordLoRaWAN = 0x34
+
+// Header is a version 0 LoRaTap header.
+type Header struct {
+	Version         uint8
+	Frequency       uint32 // Hz
+	Bandwidth       uint8  // in steps of 125 kHz
+	SpreadingFactor uint8
+	PacketRSSI      uint8 // see RSSI
+	MaxRSSI         uint8 // dBm is -139 + value
+	CurrentRSSI     uint8 // dBm is -139 + value
+	SNR             int8  // dB is value / 4
+	SyncWord        uint8
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface for Header.
+func (h Header) MarshalBinary() ([]byte, error) {
+	data := make([]byte, HeaderLength)
+	data[0] = h.Version
+	binary.BigEndian.PutUint16(data[2:4], HeaderLength)
+	binary.BigEndian.PutUint32(data[4:8], h.Frequency)
+	data[8] = h.Bandwidth
+	data[9] = h.SpreadingFactor
+	data[10] = h.PacketRSSI
+	data[11] = h.MaxRSSI
+	data[12] = h.CurrentRSSI
+	data[13] = uint8(h.SNR)
+	data[14] = h.SyncWord
+	return data, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for Header.
+func (h *Header) UnmarshalBinary(data []byte) error {
+	if len(data) < HeaderLength {
+		return errors.New("loratap header too short")
+	}
+	if data[0] != 0 {
+		return errors.New(fmt.Sprintf("unsupported loratap version: %d", data[0]))
+	}
+
+	h.Version = data[0]
+	h.Frequency = binary.BigEndian.Uint32(data[4:8])
+	h.Bandwidth = data[8]
+	h.SpreadingFactor = data[9]
+	h.PacketRSSI = data[10]
+	h.MaxRSSI = data[11]
+	h.CurrentRSSI = data[12]
+	h.SNR = int8(data[13])
+	h.SyncWord = data[14]
+	return nil
+}
+
+// RSSI returns the packet RSSI in dBm.
+func (h Header) RSSI() float64 {
+	if h.SNR >= 0 {
+		return -139 + float64(h.PacketRSSI)*16/15
+	}
+	return -139 + float64(h.PacketRSSI) + float64(h.SNR)/4
+}
+
+// Frame is a LoRaTap frame, the header followed by the PHYPayload.
+type Frame struct {
+	Header
+	Payload []byte
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface for Frame.
+func (f Frame) MarshalBinary() ([]byte, error) {
+	data, err := f.Header.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append(data, f.Payload...), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for Frame.
+func (f *Frame) UnmarshalBinary(data []byte) error {
+	err := f.Header.UnmarshalBinary(data)
+	if err != nil {
+		return errors.Wrap(err, "unmarshal frame failed")
+	}
+
+	length := int(binary.BigEndian.Uint16(data[2:4]))
+	if length < HeaderLength || length > len(data) {
+		return errors.New("unmarshal frame failed: invalid header length")
+	}
+	f.Payload = data[length:]
+	return nil
+}
+
+// newFrame returns the frame of a LoRa packet, the data is base64 encoded
+// as in the Semtech UDP protocol.
+func newFrame(freq float64, dataRate protocol.DataRate, rssi, snr float64, data string) (Frame, error) {
+	if dataRate.Modulation != protocol.LoRa {
+		return Frame{}, errors.New("new frame failed: not a LoRa packet")
+	}
+	if err := dataRate.Validate(); err != nil {
+		return Frame{}, errors.Wrap(err, "new frame failed")
+	}
+
+	payload, err := protocol.DecodeData(data)
+	if err != nil {
+		return Frame{}, errors.Wrap(err, "new frame failed")
+	}
+
+	f := Frame{
+		Header: Header{
+			Frequency:       uint32(math.Round(freq * 1e6)),
+			Bandwidth:       uint8(dataRate.Bandwidth / 125000),
+			SpreadingFactor: dataRate.SpreadingFactor,
+			SNR:             int8(clamp(snr*4, math.MinInt8, math.MaxInt8)),
+			SyncWord:        SyncWordLoRaWAN,
+		},
+		Payload: payload,
+	}
+
+	packetRSSI := rssi + 139 - snr
+	if snr >= 0 {
+		packetRSSI = (rssi + 139) * 15 / 16
+	}
+	f.PacketRSSI = uint8(clamp(packetRSSI, 0, math.MaxUint8))
+	f.MaxRSSI = uint8(clamp(rssi+139, 0, math.MaxUint8))
+	f.CurrentRSSI = f.MaxRSSI
+
+	return f, nil
+}
+
+// NewRXFrame returns the frame of a received packet.
+func NewRXFrame(rxpk *protocol.RXPK) (Frame, error) {
+	if rxpk.DatR == nil {
+		return Frame{}, errors.New("new frame failed: no data rate")
+	}
+	var snr float64
+	if rxpk.SNR != nil {
+		snr = *rxpk.SNR
+	}
+	return newFrame(rxpk.Freq, *rxpk.DatR, float64(rxpk.RSSI), snr, rxpk.Data)
+}
+
+// NewTXFrame returns the frame of a packet to be emitted, it has no signal
+// information.
+func NewTXFrame(txpk *protocol.TXPK) (Frame, error) {
+	return newFrame(txpk.Freq, txpk.DatR, -139, 0, txpk.Data)
+}
+
+// RXPK returns the frame as a received packet, received at the given time.
+// LoRaTap has no CRC status nor coding rate, the CRC is assumed to be OK.
+func (f *Frame) RXPK(t time.Time) (*protocol.RXPK, error) {
+	dataRate, err := protocol.NewLoRaDataRate(f.SpreadingFactor, uint32(f.Bandwidth)*125000)
+	if err != nil {
+		return nil, errors.Wrap(err, "rxpk failed")
+	}
+
+	rxTime := protocol.CompactTime(t)
+	snr := float64(f.SNR) / 4
+	return &protocol.RXPK{
+		Time: &rxTime,
+		Freq: float64(f.Frequency) / 1e6,
+		Stat: 1,
+		Mod:  string(protocol.LoRa),
+		DatR: &dataRate,
+		RSSI: int16(math.Round(f.RSSI())),
+		SNR:  &snr,
+		Size: uint16(len(f.Payload)),
+		Data: base64.StdEncoding.EncodeToString(f.Payload),
+	}, nil
+}
+
+func clamp(v, min, max float64) float64 {
+	return math.Max(min, math.Min(max, math.Round(v)))
+}
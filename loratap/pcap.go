@@ -0,0 +1,174 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loratap
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/pkg/errors"
+)
+
+// pcap file header constants
+const (
+	magicMicroseconds = 0xa1b2c3d4
+	magicNanoseconds  = 0xa1b23c4d
+	versionMajor      = 2
+	versionMinor      = 4
+	fileHeaderLength  = 24
+)
+
+// snapshotLength is larger than any LoRa frame with a LoRaTap header.
+const snapshotLength = 65535
+
+// ErrNotLoRaTap is returned when opening a capture file with another link
+// type than LoRaTap.
+var ErrNotLoRaTap = errors.New("not a loratap capture")
+
+// Writer writes LoRaTap frames to a pcap file.
+type Writer struct {
+	file   *os.File
+	writer *pcapgo.Writer
+}
+
+// Create creates (or truncates) the pcap file.
+func Create(path string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "create failed")
+	}
+
+	var header [fileHeaderLength]byte
+	binary.LittleEndian.PutUint32(header[0:4], magicMicroseconds)
+	binary.LittleEndian.PutUint16(header[4:6], versionMajor)
+	binary.LittleEndian.PutUint16(header[6:8], versionMinor)
+	binary.LittleEndian.PutUint32(header[16:20], snapshotLength)
+	binary.LittleEndian.PutUint32(header[20:24], LinkType)
+	_, err = f.Write(header[:])
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "create failed")
+	}
+
+	return &Writer{file: f, writer: pcapgo.NewWriter(f)}, nil
+}
+
+// WriteFrame writes the frame captured at the given time.
+func (w *Writer) WriteFrame(t time.Time, f Frame) error {
+	data, err := f.MarshalBinary()
+	if err != nil {
+		return errors.Wrap(err, "write frame failed")
+	}
+
+	ci := gopacket.CaptureInfo{
+		Timestamp:     t,
+		CaptureLength: len(data),
+		Length:        len(data),
+	}
+	err = w.writer.WritePacket(ci, data)
+	if err != nil {
+		return errors.Wrap(err, "write frame failed")
+	}
+
+	return nil
+}
+
+// Close closes the pcap file.
+func (w *Writer) Close() error {
+	return w.file.Close()
+}
+
+// Reader reads LoRaTap frames from a pcap file.
+type Reader struct {
+	file   *os.File
+	reader *pcapgo.Reader
+}
+
+// Open opens the pcap file, ErrNotLoRaTap is returned when the file is not
+// a pcap file with the LoRaTap link type (pcapng is not supported).
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open failed")
+	}
+
+	ok, err := isLoRaTap(f)
+	if err == nil && !ok {
+		err = ErrNotLoRaTap
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	r, err := pcapgo.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "open failed")
+	}
+
+	return &Reader{file: f, reader: r}, nil
+}
+
+// isLoRaTap reads the pcap file header and checks the link type.
+func isLoRaTap(r io.Reader) (bool, error) {
+	var header [fileHeaderLength]byte
+	_, err := io.ReadFull(r, header[:])
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "read file header failed")
+	}
+
+	var byteOrder binary.ByteOrder
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		magic := order.Uint32(header[0:4])
+		if magic == magicMicroseconds || magic == magicNanoseconds {
+			byteOrder = order
+		}
+	}
+	if byteOrder == nil {
+		return false, nil
+	}
+
+	return byteOrder.Uint32(header[20:24])&0xffff == LinkType, nil
+}
+
+// ReadPacketData reads the next LoRaTap frame and its capture info, io.EOF
+// is returned at the end of the file.
+func (r *Reader) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	return r.reader.ReadPacketData()
+}
+
+// Close closes the pcap file.
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
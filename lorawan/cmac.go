@@ -0,0 +1,91 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lorawan
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+)
+
+// cmac computes the AES-CMAC (RFC 4493) of data with the given key.
+func cmac(key AES128Key, data []byte) []byte {
+	block := newCipher(key)
+
+	// generate the subkeys
+	k1 := make([]byte, aes.BlockSize)
+	block.Encrypt(k1, k1)
+	k1 = shiftSubkey(k1)
+	k2 := shiftSubkey(k1)
+
+	n := (len(data) + aes.BlockSize - 1) / aes.BlockSize
+	complete := n > 0 && len(data)%aes.BlockSize == 0
+	if n == 0 {
+		n = 1
+	}
+
+	last := make([]byte, aes.BlockSize)
+	copy(last, data[(n-1)*aes.BlockSize:])
+	if complete {
+		xor(last, k1)
+	} else {
+		last[len(data)-(n-1)*aes.BlockSize] = 0x80
+		xor(last, k2)
+	}
+
+	x := make([]byte, aes.BlockSize)
+	for i := 0; i < n-1; i++ {
+		xor(x, data[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		block.Encrypt(x, x)
+	}
+	xor(x, last)
+	block.Encrypt(x, x)
+
+	return x
+}
+
+// shiftSubkey derives the next CMAC subkey.
+func shiftSubkey(k []byte) []byte {
+	out := make([]byte, len(k))
+	for i := 0; i < len(k)-1; i++ {
+		out[i] = k[i]<<1 | k[i+1]>>7
+	}
+	out[len(k)-1] = k[len(k)-1] << 1
+	if k[0]&0x80 != 0 {
+		out[len(k)-1] ^= 0x87
+	}
+	return out
+}
+
+// xor sets dst to dst ^ src.
+func xor(dst, src []byte) {
+	for i := range src {
+		dst[i] ^= src[i]
+	}
+}
+
+// newCipher returns the AES block cipher for key.
+func newCipher(key AES128Key) cipher.Block {
+	// aes.NewCipher only fails on invalid key sizes
+	block, _ := aes.NewCipher(key[:])
+	return block
+}
@@ -0,0 +1,85 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lorawan
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// mustDecodeHex decodes hex test vectors.
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid test vector %q: %v", s, err)
+	}
+	return b
+}
+
+// mustKey decodes a hex AES key test vector.
+func mustKey(t *testing.T, s string) AES128Key {
+	var key AES128Key
+	if err := key.UnmarshalText([]byte(s)); err != nil {
+		t.Fatalf("invalid test key %q: %v", s, err)
+	}
+	return key
+}
+
+// TestCMAC uses the test vectors of RFC 4493 section 4.
+func TestCMAC(t *testing.T) {
+	key := mustKey(t, "2B7E151628AED2A6ABF7158809CF4F3C")
+	message := "6BC1BEE22E409F96E93D7E117393172AAE2D8A571E03AC9C9EB76FAC45AF8E5130C81C46A35CE411E5FBC1191A0A52EFF69F2445DF4F9B17AD2B417BE66C3710"
+
+	tests := []struct {
+		length int
+		mac    string
+	}{
+		{0, "BB1D6929E95937287FA37D129B756746"},
+		{16, "070A16B46B4D4144F79BDD9DD04A287C"},
+		{40, "DFA66747DE9AE63030CA32611497C827"},
+		{64, "51F0BEBF7E3B9D92FC49741779363CFE"},
+	}
+
+	for _, test := range tests {
+		data := mustDecodeHex(t, message)[:test.length]
+		mac := cmac(key, data)
+		if want := mustDecodeHex(t, test.mac); !bytes.Equal(mac, want) {
+			t.Errorf("length %d: cmac %X, expected %X", test.length, mac, want)
+		}
+	}
+}
+
+// TestCMACSubkeys uses the subkeys of RFC 4493 section 4.
+func TestCMACSubkeys(t *testing.T) {
+	l := mustDecodeHex(t, "7DF76B0C1AB899B33E42F047B91B546F")
+
+	k1 := shiftSubkey(l)
+	if want := mustDecodeHex(t, "FBEED618357133667C85E08F7236A8DE"); !bytes.Equal(k1, want) {
+		t.Errorf("k1 %X, expected %X", k1, want)
+	}
+	k2 := shiftSubkey(k1)
+	if want := mustDecodeHex(t, "F7DDAC306AE266CCF90BC11EE46D513B"); !bytes.Equal(k2, want) {
+		t.Errorf("k2 %X, expected %X", k2, want)
+	}
+}
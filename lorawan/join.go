@@ -0,0 +1,215 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lorawan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+)
+
+// JoinRequestPayload is the payload of a join-request message.
+type JoinRequestPayload struct {
+	JoinEUI  EUI64
+	DevEUI   EUI64
+	DevNonce uint16
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for JoinRequestPayload.
+func (p *JoinRequestPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 18 {
+		return errors.New("invalid join request payload: 18 bytes expected")
+	}
+
+	copy(p.JoinEUI[:], reverse(data[0:8]))
+	copy(p.DevEUI[:], reverse(data[8:16]))
+	p.DevNonce = binary.LittleEndian.Uint16(data[16:18])
+
+	return nil
+}
+
+// Fields implements the Payload interface for JoinRequestPayload.
+func (p *JoinRequestPayload) Fields() log.Fields {
+	return log.Fields{
+		"join eui":  p.JoinEUI,
+		"dev eui":   p.DevEUI,
+		"dev nonce": p.DevNonce,
+	}
+}
+
+// DLSettings contains the downlink configuration sent in a join-accept.
+// OptNeg is set by a LoRaWAN 1.1 network server.
+type DLSettings struct {
+	OptNeg      bool
+	RX1DROffset uint8
+	RX2DataRate uint8
+}
+
+// JoinAcceptPayload is the payload of a join-accept message. The payload is
+// sent encrypted, only Encrypted is valid until it has been decrypted with
+// PHYPayload.DecryptJoinAccept.
+type JoinAcceptPayload struct {
+	JoinNonce  uint32
+	NetID      [3]byte
+	DevAddr    DevAddr
+	DLSettings DLSettings
+	RxDelay    uint8
+	CFList     []byte
+	Encrypted  bool
+
+	// ciphertext contains the encrypted payload and MIC
+	ciphertext []byte
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for JoinAcceptPayload.
+// The data must already be decrypted.
+func (p *JoinAcceptPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 12 && len(data) != 28 {
+		return errors.New("invalid join accept payload: 12 or 28 bytes expected")
+	}
+
+	p.JoinNonce = uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+	copy(p.NetID[:], reverse(data[3:6]))
+	copy(p.DevAddr[:], reverse(data[6:10]))
+	p.DLSettings.OptNeg = data[10]&0x80 != 0
+	p.DLSettings.RX1DROffset = (data[10] >> 4) & 0x07
+	p.DLSettings.RX2DataRate = data[10] & 0x0f
+	p.RxDelay = data[11] & 0x0f
+
+	p.CFList = nil
+	if len(data) == 28 {
+		p.CFList = append([]byte(nil), data[12:28]...)
+	}
+
+	return nil
+}
+
+// Fields implements the Payload interface for JoinAcceptPayload.
+func (p *JoinAcceptPayload) Fields() log.Fields {
+	if p.Encrypted {
+		return log.Fields{
+			"encrypted": true,
+		}
+	}
+
+	fields := log.Fields{
+		"join nonce":           p.JoinNonce,
+		"net id":               fmt.Sprintf("%X", p.NetID),
+		"device address":       p.DevAddr,
+		"opt neg":              p.DLSettings.OptNeg,
+		"rx1 data rate offset": p.DLSettings.RX1DROffset,
+		"rx2 data rate":        p.DLSettings.RX2DataRate,
+		"rx delay":             p.RxDelay,
+	}
+
+	if len(p.CFList) == 16 {
+		fields["cf list"] = fmt.Sprintf("%X", p.CFList)
+		// CFList type 0 contains the frequencies of channel 3 to 7
+		if p.CFList[15] == 0 {
+			var frequencies []uint32
+			for i := 0; i < 15; i += 3 {
+				if f := frequency(p.CFList[i : i+3]); f != 0 {
+					frequencies = append(frequencies, f)
+				}
+			}
+			fields["cf list frequencies"] = frequencies
+		}
+	}
+
+	return fields
+}
+
+// DecryptJoinAccept decrypts the join-accept payload and MIC with appKey.
+// The payload is only replaced when the decrypted MIC is valid, ok reports
+// whether this was the case.
+func (p *PHYPayload) DecryptJoinAccept(appKey AES128Key) (ok bool, err error) {
+	return p.decryptJoinAccept(appKey, func(msg []byte) []byte {
+		return cmac(appKey, msg)
+	})
+}
+
+// DecryptJoinAccept11 decrypts the join-accept payload and MIC sent to a
+// LoRaWAN 1.1 end-device in answer to a join-request. When the network
+// server also runs 1.1 (OptNeg), the MIC covers the JoinEUI and DevNonce of
+// the join-request and is computed with the JSIntKey.
+func (p *PHYPayload) DecryptJoinAccept11(nwkKey AES128Key, devEUI, joinEUI EUI64, devNonce uint16) (ok bool, err error) {
+	jsIntKey := deriveJSKey(nwkKey, 0x06, devEUI)
+
+	return p.decryptJoinAccept(nwkKey, func(msg []byte) []byte {
+		// OptNeg is bit 7 of DLSettings
+		if msg[11]&0x80 == 0 {
+			return cmac(nwkKey, msg)
+		}
+
+		b := []byte{0xff}
+		b = append(b, reverse(joinEUI[:])...)
+		b = append(b, byte(devNonce), byte(devNonce>>8))
+		return cmac(jsIntKey, append(b, msg...))
+	})
+}
+
+// decryptJoinAccept decrypts the join-accept with key and checks the MIC
+// returned by mic for the MHDR and decrypted payload.
+func (p *PHYPayload) decryptJoinAccept(key AES128Key, mic func(msg []byte) []byte) (bool, error) {
+	payload, isJoinAccept := p.Payload.(*JoinAcceptPayload)
+	if !isJoinAccept {
+		return false, errors.New("decrypt join accept failed: no join accept payload")
+	}
+
+	if !payload.Encrypted {
+		return false, errors.New("decrypt join accept failed: payload not encrypted")
+	}
+
+	ciphertext := payload.ciphertext
+	if len(ciphertext) != 16 && len(ciphertext) != 32 {
+		return false, errors.New("decrypt join accept failed: 16 or 32 bytes expected")
+	}
+
+	// the network server encrypts with an AES decrypt operation, so the
+	// end-device decrypts with an AES encrypt operation
+	block := newCipher(key)
+	plaintext := make([]byte, len(ciphertext))
+	for i := 0; i < len(ciphertext); i += 16 {
+		block.Encrypt(plaintext[i:i+16], ciphertext[i:i+16])
+	}
+
+	mhdr, _ := p.MHDR.MarshalBinary()
+	expected := mic(append(mhdr, plaintext[:len(plaintext)-4]...))
+	if !bytes.Equal(expected[:4], plaintext[len(plaintext)-4:]) {
+		return false, nil
+	}
+
+	decrypted := JoinAcceptPayload{ciphertext: ciphertext}
+	err := decrypted.UnmarshalBinary(plaintext[:len(plaintext)-4])
+	if err != nil {
+		return false, errors.Wrap(err, "decrypt join accept failed")
+	}
+
+	p.Payload = &decrypted
+	copy(p.MIC[:], plaintext[len(plaintext)-4:])
+
+	return true, nil
+}
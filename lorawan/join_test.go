@@ -0,0 +1,113 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lorawan
+
+import (
+	"testing"
+)
+
+// The join vectors follow the LoRaWAN 1.0.2 join procedure (section 6.2),
+// their MIC and encryption were computed with the OpenSSL AES and CMAC
+// implementations: device 0004A30B001C0532 with AppKey
+// 505152535455565758595A5B5C5D5E5F joins JoinEUI 70B3D57ED0000000 with
+// DevNonce 0x1234 and receives DevAddr 26011BDA of NetID 000013.
+const (
+	joinAppKey  = "505152535455565758595A5B5C5D5E5F"
+	joinRequest = "00000000D07ED5B37032051C000BA3040034126C3938D4"
+	joinAccept  = "20666C7DE779D6A1CD334800EC7C094DB1"
+)
+
+func TestJoinRequest(t *testing.T) {
+	var phy PHYPayload
+	if err := phy.UnmarshalBinary(mustDecodeHex(t, joinRequest)); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+
+	payload, ok := phy.Payload.(*JoinRequestPayload)
+	if !ok {
+		t.Fatalf("payload %T, expected *JoinRequestPayload", phy.Payload)
+	}
+	want := JoinRequestPayload{
+		JoinEUI:  EUI64{0x70, 0xB3, 0xD5, 0x7E, 0xD0, 0x00, 0x00, 0x00},
+		DevEUI:   EUI64{0x00, 0x04, 0xA3, 0x0B, 0x00, 0x1C, 0x05, 0x32},
+		DevNonce: 0x1234,
+	}
+	if *payload != want {
+		t.Errorf("join request %+v, expected %+v", *payload, want)
+	}
+
+	ok, err := phy.ValidateJoinRequestMIC(mustKey(t, joinAppKey))
+	if err != nil || !ok {
+		t.Errorf("mic not valid: %v", err)
+	}
+	ok, err = phy.ValidateJoinRequestMIC(AES128Key{})
+	if err != nil || ok {
+		t.Errorf("mic valid with the wrong key: %v", err)
+	}
+}
+
+func TestDecryptJoinAccept(t *testing.T) {
+	var phy PHYPayload
+	if err := phy.UnmarshalBinary(mustDecodeHex(t, joinAccept)); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if payload, ok := phy.Payload.(*JoinAcceptPayload); !ok || !payload.Encrypted {
+		t.Fatalf("payload %+v, expected an encrypted join accept", phy.Payload)
+	}
+
+	ok, err := phy.DecryptJoinAccept(AES128Key{})
+	if err != nil || ok {
+		t.Fatalf("decrypted with the wrong key: %v", err)
+	}
+	if payload := phy.Payload.(*JoinAcceptPayload); !payload.Encrypted {
+		t.Fatal("payload replaced although the mic is not valid")
+	}
+
+	ok, err = phy.DecryptJoinAccept(mustKey(t, joinAppKey))
+	if err != nil || !ok {
+		t.Fatalf("mic not valid: %v", err)
+	}
+
+	payload := phy.Payload.(*JoinAcceptPayload)
+	if payload.Encrypted {
+		t.Error("payload still encrypted")
+	}
+	if payload.JoinNonce != 0x123456 {
+		t.Errorf("join nonce %X, expected 123456", payload.JoinNonce)
+	}
+	if payload.NetID != [3]byte{0x00, 0x00, 0x13} {
+		t.Errorf("net id %X, expected 000013", payload.NetID)
+	}
+	if want := (DevAddr{0x26, 0x01, 0x1B, 0xDA}); payload.DevAddr != want {
+		t.Errorf("device address %s, expected %s", payload.DevAddr, want)
+	}
+	if want := (DLSettings{RX2DataRate: 2}); payload.DLSettings != want {
+		t.Errorf("dl settings %+v, expected %+v", payload.DLSettings, want)
+	}
+	if payload.RxDelay != 1 || payload.CFList != nil {
+		t.Errorf("rx delay %d and cf list %X, expected 1 and none", payload.RxDelay, payload.CFList)
+	}
+	if want := [4]byte{0x1B, 0xE7, 0x47, 0x75}; phy.MIC != want {
+		t.Errorf("mic %X, expected %X", phy.MIC, want)
+	}
+}
@@ -0,0 +1,93 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lorawan
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// EUI64 is a 64 bit extended unique identifier (eg. DevEUI or JoinEUI).
+type EUI64 [8]byte
+
+// String implements the stringer interface for EUI64.
+func (e EUI64) String() string {
+	return fmt.Sprintf("%X", e[:])
+}
+
+// MarshalText implements the encoding.TextMarshaler interface for EUI64.
+func (e EUI64) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface for EUI64.
+func (e *EUI64) UnmarshalText(text []byte) error {
+	return decodeHex(e[:], text)
+}
+
+// AES128Key is a 128 bit AES key (eg. AppKey or NwkSKey).
+type AES128Key [16]byte
+
+// String implements the stringer interface for AES128Key.
+func (k AES128Key) String() string {
+	return fmt.Sprintf("%X", k[:])
+}
+
+// MarshalText implements the encoding.TextMarshaler interface for AES128Key.
+func (k AES128Key) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface for AES128Key.
+func (k *AES128Key) UnmarshalText(text []byte) error {
+	return decodeHex(k[:], text)
+}
+
+// decodeHex decodes the hex encoded text into dst, the length of the text
+// must match the length of dst.
+func decodeHex(dst []byte, text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return errors.Wrap(err, "decode hex failed")
+	}
+
+	if len(b) != len(dst) {
+		return errors.New(fmt.Sprintf("invalid hex: %d bytes expected", len(dst)))
+	}
+
+	copy(dst, b)
+
+	return nil
+}
+
+// reverse returns a copy of data in reversed byte order, LoRaWAN sends most
+// identifiers little endian.
+func reverse(data []byte) []byte {
+	out := make([]byte, len(data))
+	for i := range data {
+		out[len(data)-1-i] = data[i]
+	}
+	return out
+}
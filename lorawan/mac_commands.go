@@ -0,0 +1,877 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lorawan
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+)
+
+// CID defines the command identifier of a MAC command.
+type CID byte
+
+// Available command identifiers, Reset, Rekey, ADRParamSetup, ForceRejoin
+// and RejoinParamSetup are only used by LoRaWAN 1.1. PingSlotInfo,
+// PingSlotChannel, BeaconTiming and BeaconFreq are the Class B commands.
+const (
+	Reset            CID = 0x01
+	LinkCheck        CID = 0x02
+	LinkADR          CID = 0x03
+	DutyCycle        CID = 0x04
+	RXParamSetup     CID = 0x05
+	DevStatus        CID = 0x06
+	NewChannel       CID = 0x07
+	RXTimingSetup    CID = 0x08
+	TXParamSetup     CID = 0x09
+	DlChannel        CID = 0x0A
+	Rekey            CID = 0x0B
+	ADRParamSetup    CID = 0x0C
+	DeviceTime       CID = 0x0D
+	ForceRejoin      CID = 0x0E
+	RejoinParamSetup CID = 0x0F
+	PingSlotInfo     CID = 0x10
+	PingSlotChannel  CID = 0x11
+	BeaconTiming     CID = 0x12
+	BeaconFreq       CID = 0x13
+)
+
+// MACCommandPayload is implemented by the payloads of the MAC commands.
+type MACCommandPayload interface {
+	UnmarshalBinary(data []byte) error
+	Fields() log.Fields
+}
+
+// MACCommand is a MAC command sent in the FOpts field or as FRMPayload on
+// port 0.
+type MACCommand struct {
+	CID     CID
+	Uplink  bool
+	Payload MACCommandPayload
+}
+
+// Name returns the name of the command (eg. LinkADRReq).
+func (c MACCommand) Name() string {
+	item, ok := macCommandRegistry[c.Uplink][c.CID]
+	if !ok {
+		return fmt.Sprintf("CID(0x%02X)", byte(c.CID))
+	}
+	return item.name
+}
+
+// Fields returns the decoded command as log fields.
+func (c MACCommand) Fields() log.Fields {
+	fields := log.Fields{
+		"command": c.Name(),
+	}
+
+	if c.Payload != nil {
+		for k, v := range c.Payload.Fields() {
+			fields[k] = v
+		}
+	}
+
+	return fields
+}
+
+type macCommandItem struct {
+	name    string
+	size    int
+	payload func() MACCommandPayload
+}
+
+// macCommandRegistry contains the MAC commands by direction (uplink is true)
+// and command identifier.
+var macCommandRegistry = map[bool]map[CID]macCommandItem{
+	true: {
+		Reset:            {"ResetInd", 1, func() MACCommandPayload { return &VersionPayload{} }},
+		LinkCheck:        {"LinkCheckReq", 0, nil},
+		LinkADR:          {"LinkADRAns", 1, func() MACCommandPayload { return &LinkADRAnsPayload{} }},
+		DutyCycle:        {"DutyCycleAns", 0, nil},
+		RXParamSetup:     {"RXParamSetupAns", 1, func() MACCommandPayload { return &RXParamSetupAnsPayload{} }},
+		DevStatus:        {"DevStatusAns", 2, func() MACCommandPayload { return &DevStatusAnsPayload{} }},
+		NewChannel:       {"NewChannelAns", 1, func() MACCommandPayload { return &NewChannelAnsPayload{} }},
+		RXTimingSetup:    {"RXTimingSetupAns", 0, nil},
+		TXParamSetup:     {"TXParamSetupAns", 0, nil},
+		DlChannel:        {"DlChannelAns", 1, func() MACCommandPayload { return &DlChannelAnsPayload{} }},
+		Rekey:            {"RekeyInd", 1, func() MACCommandPayload { return &VersionPayload{} }},
+		ADRParamSetup:    {"ADRParamSetupAns", 0, nil},
+		DeviceTime:       {"DeviceTimeReq", 0, nil},
+		RejoinParamSetup: {"RejoinParamSetupAns", 1, func() MACCommandPayload { return &RejoinParamSetupAnsPayload{} }},
+		PingSlotInfo:     {"PingSlotInfoReq", 1, func() MACCommandPayload { return &PingSlotInfoReqPayload{} }},
+		PingSlotChannel:  {"PingSlotChannelAns", 1, func() MACCommandPayload { return &PingSlotChannelAnsPayload{} }},
+		BeaconTiming:     {"BeaconTimingReq", 0, nil},
+		BeaconFreq:       {"BeaconFreqAns", 1, func() MACCommandPayload { return &BeaconFreqAnsPayload{} }},
+	},
+	false: {
+		Reset:            {"ResetConf", 1, func() MACCommandPayload { return &VersionPayload{} }},
+		LinkCheck:        {"LinkCheckAns", 2, func() MACCommandPayload { return &LinkCheckAnsPayload{} }},
+		LinkADR:          {"LinkADRReq", 4, func() MACCommandPayload { return &LinkADRReqPayload{} }},
+		DutyCycle:        {"DutyCycleReq", 1, func() MACCommandPayload { return &DutyCycleReqPayload{} }},
+		RXParamSetup:     {"RXParamSetupReq", 4, func() MACCommandPayload { return &RXParamSetupReqPayload{} }},
+		DevStatus:        {"DevStatusReq", 0, nil},
+		NewChannel:       {"NewChannelReq", 5, func() MACCommandPayload { return &NewChannelReqPayload{} }},
+		RXTimingSetup:    {"RXTimingSetupReq", 1, func() MACCommandPayload { return &RXTimingSetupReqPayload{} }},
+		TXParamSetup:     {"TXParamSetupReq", 1, func() MACCommandPayload { return &TXParamSetupReqPayload{} }},
+		DlChannel:        {"DlChannelReq", 4, func() MACCommandPayload { return &DlChannelReqPayload{} }},
+		Rekey:            {"RekeyConf", 1, func() MACCommandPayload { return &VersionPayload{} }},
+		ADRParamSetup:    {"ADRParamSetupReq", 1, func() MACCommandPayload { return &ADRParamSetupReqPayload{} }},
+		DeviceTime:       {"DeviceTimeAns", 5, func() MACCommandPayload { return &DeviceTimeAnsPayload{} }},
+		ForceRejoin:      {"ForceRejoinReq", 2, func() MACCommandPayload { return &ForceRejoinReqPayload{} }},
+		RejoinParamSetup: {"RejoinParamSetupReq", 1, func() MACCommandPayload { return &RejoinParamSetupReqPayload{} }},
+		PingSlotInfo:     {"PingSlotInfoAns", 0, nil},
+		PingSlotChannel:  {"PingSlotChannelReq", 4, func() MACCommandPayload { return &PingSlotChannelReqPayload{} }},
+		BeaconTiming:     {"BeaconTimingAns", 3, func() MACCommandPayload { return &BeaconTimingAnsPayload{} }},
+		BeaconFreq:       {"BeaconFreqReq", 3, func() MACCommandPayload { return &BeaconFreqReqPayload{} }},
+	},
+}
+
+// DecodeMACCommands decodes the MAC commands in data. Decoding stops at the
+// first unknown command, since its length can not be determined. The
+// commands decoded up to that point are returned together with an error that
+// reports the bytes left undecoded.
+func DecodeMACCommands(uplink bool, data []byte) ([]MACCommand, error) {
+	var commands []MACCommand
+
+	for i := 0; i < len(data); {
+		cid := CID(data[i])
+		item, ok := macCommandRegistry[uplink][cid]
+		if !ok {
+			return commands, errors.New(fmt.Sprintf("unknown mac command: CID 0x%02X, %X undecoded", byte(cid), data[i:]))
+		}
+		i++
+
+		if len(data) < i+item.size {
+			return commands, errors.New(fmt.Sprintf("invalid mac command %s: %d bytes expected, %X undecoded", item.name, item.size, data[i-1:]))
+		}
+
+		command := MACCommand{
+			CID:    cid,
+			Uplink: uplink,
+		}
+		if item.payload != nil {
+			command.Payload = item.payload()
+			err := command.Payload.UnmarshalBinary(data[i : i+item.size])
+			if err != nil {
+				return commands, errors.Wrap(err, "decode mac commands failed")
+			}
+		}
+		i += item.size
+
+		commands = append(commands, command)
+	}
+
+	return commands, nil
+}
+
+// macCommandsFields returns the commands as a list of log fields.
+func macCommandsFields(commands []MACCommand) []log.Fields {
+	list := make([]log.Fields, 0, len(commands))
+	for _, command := range commands {
+		list = append(list, command.Fields())
+	}
+	return list
+}
+
+// frequency decodes the 24 bit frequency (in steps of 100 Hz) to Hz.
+func frequency(data []byte) uint32 {
+	return (uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16) * 100
+}
+
+// LinkCheckAnsPayload is the payload of a LinkCheckAns command.
+type LinkCheckAnsPayload struct {
+	Margin uint8
+	GwCnt  uint8
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for LinkCheckAnsPayload.
+func (p *LinkCheckAnsPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 2 {
+		return errors.New("invalid link check ans payload: 2 bytes expected")
+	}
+
+	p.Margin = data[0]
+	p.GwCnt = data[1]
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for LinkCheckAnsPayload.
+func (p *LinkCheckAnsPayload) Fields() log.Fields {
+	return log.Fields{
+		"margin":        p.Margin,
+		"gateway count": p.GwCnt,
+	}
+}
+
+// LinkADRReqPayload is the payload of a LinkADRReq command.
+type LinkADRReqPayload struct {
+	DataRate   uint8
+	TXPower    uint8
+	ChMask     uint16
+	ChMaskCntl uint8
+	NbTrans    uint8
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for LinkADRReqPayload.
+func (p *LinkADRReqPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 4 {
+		return errors.New("invalid link adr req payload: 4 bytes expected")
+	}
+
+	p.DataRate = data[0] >> 4
+	p.TXPower = data[0] & 0x0f
+	p.ChMask = uint16(data[1]) | uint16(data[2])<<8
+	p.ChMaskCntl = (data[3] >> 4) & 0x07
+	p.NbTrans = data[3] & 0x0f
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for LinkADRReqPayload.
+func (p *LinkADRReqPayload) Fields() log.Fields {
+	return log.Fields{
+		"data rate":            p.DataRate,
+		"tx power":             p.TXPower,
+		"channel mask":         fmt.Sprintf("%016b", p.ChMask),
+		"channel mask control": p.ChMaskCntl,
+		"nb trans":             p.NbTrans,
+	}
+}
+
+// LinkADRAnsPayload is the payload of a LinkADRAns command.
+type LinkADRAnsPayload struct {
+	PowerACK       bool
+	DataRateACK    bool
+	ChannelMaskACK bool
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for LinkADRAnsPayload.
+func (p *LinkADRAnsPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 1 {
+		return errors.New("invalid link adr ans payload: 1 byte expected")
+	}
+
+	p.PowerACK = data[0]&0x04 != 0
+	p.DataRateACK = data[0]&0x02 != 0
+	p.ChannelMaskACK = data[0]&0x01 != 0
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for LinkADRAnsPayload.
+func (p *LinkADRAnsPayload) Fields() log.Fields {
+	return log.Fields{
+		"power ack":        p.PowerACK,
+		"data rate ack":    p.DataRateACK,
+		"channel mask ack": p.ChannelMaskACK,
+	}
+}
+
+// DutyCycleReqPayload is the payload of a DutyCycleReq command.
+type DutyCycleReqPayload struct {
+	MaxDCycle uint8
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for DutyCycleReqPayload.
+func (p *DutyCycleReqPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 1 {
+		return errors.New("invalid duty cycle req payload: 1 byte expected")
+	}
+
+	p.MaxDCycle = data[0] & 0x0f
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for DutyCycleReqPayload.
+func (p *DutyCycleReqPayload) Fields() log.Fields {
+	return log.Fields{
+		"max duty cycle": p.MaxDCycle,
+	}
+}
+
+// RXParamSetupReqPayload is the payload of a RXParamSetupReq command.
+type RXParamSetupReqPayload struct {
+	RX1DROffset uint8
+	RX2DataRate uint8
+	Frequency   uint32
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for RXParamSetupReqPayload.
+func (p *RXParamSetupReqPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 4 {
+		return errors.New("invalid rx param setup req payload: 4 bytes expected")
+	}
+
+	p.RX1DROffset = (data[0] >> 4) & 0x07
+	p.RX2DataRate = data[0] & 0x0f
+	p.Frequency = frequency(data[1:4])
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for RXParamSetupReqPayload.
+func (p *RXParamSetupReqPayload) Fields() log.Fields {
+	return log.Fields{
+		"rx1 data rate offset": p.RX1DROffset,
+		"rx2 data rate":        p.RX2DataRate,
+		"frequency":            p.Frequency,
+	}
+}
+
+// RXParamSetupAnsPayload is the payload of a RXParamSetupAns command.
+type RXParamSetupAnsPayload struct {
+	RX1DROffsetACK bool
+	RX2DataRateACK bool
+	ChannelACK     bool
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for RXParamSetupAnsPayload.
+func (p *RXParamSetupAnsPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 1 {
+		return errors.New("invalid rx param setup ans payload: 1 byte expected")
+	}
+
+	p.RX1DROffsetACK = data[0]&0x04 != 0
+	p.RX2DataRateACK = data[0]&0x02 != 0
+	p.ChannelACK = data[0]&0x01 != 0
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for RXParamSetupAnsPayload.
+func (p *RXParamSetupAnsPayload) Fields() log.Fields {
+	return log.Fields{
+		"rx1 data rate offset ack": p.RX1DROffsetACK,
+		"rx2 data rate ack":        p.RX2DataRateACK,
+		"channel ack":              p.ChannelACK,
+	}
+}
+
+// DevStatusAnsPayload is the payload of a DevStatusAns command. Battery is 0
+// when the end-device is connected to an external power source and 255 when
+// the battery level could not be measured.
+type DevStatusAnsPayload struct {
+	Battery uint8
+	Margin  int8
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for DevStatusAnsPayload.
+func (p *DevStatusAnsPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 2 {
+		return errors.New("invalid dev status ans payload: 2 bytes expected")
+	}
+
+	p.Battery = data[0]
+	// margin is a 6 bit signed integer
+	p.Margin = int8(data[1]<<2) >> 2
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for DevStatusAnsPayload.
+func (p *DevStatusAnsPayload) Fields() log.Fields {
+	return log.Fields{
+		"battery": p.Battery,
+		"margin":  p.Margin,
+	}
+}
+
+// NewChannelReqPayload is the payload of a NewChannelReq command.
+type NewChannelReqPayload struct {
+	ChIndex   uint8
+	Frequency uint32
+	MaxDR     uint8
+	MinDR     uint8
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for NewChannelReqPayload.
+func (p *NewChannelReqPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 5 {
+		return errors.New("invalid new channel req payload: 5 bytes expected")
+	}
+
+	p.ChIndex = data[0]
+	p.Frequency = frequency(data[1:4])
+	p.MaxDR = data[4] >> 4
+	p.MinDR = data[4] & 0x0f
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for NewChannelReqPayload.
+func (p *NewChannelReqPayload) Fields() log.Fields {
+	return log.Fields{
+		"channel index": p.ChIndex,
+		"frequency":     p.Frequency,
+		"max data rate": p.MaxDR,
+		"min data rate": p.MinDR,
+	}
+}
+
+// NewChannelAnsPayload is the payload of a NewChannelAns command.
+type NewChannelAnsPayload struct {
+	DataRateRangeOK    bool
+	ChannelFrequencyOK bool
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for NewChannelAnsPayload.
+func (p *NewChannelAnsPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 1 {
+		return errors.New("invalid new channel ans payload: 1 byte expected")
+	}
+
+	p.DataRateRangeOK = data[0]&0x02 != 0
+	p.ChannelFrequencyOK = data[0]&0x01 != 0
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for NewChannelAnsPayload.
+func (p *NewChannelAnsPayload) Fields() log.Fields {
+	return log.Fields{
+		"data rate range ok":   p.DataRateRangeOK,
+		"channel frequency ok": p.ChannelFrequencyOK,
+	}
+}
+
+// RXTimingSetupReqPayload is the payload of a RXTimingSetupReq command.
+// A delay of 0 means 1 second.
+type RXTimingSetupReqPayload struct {
+	Delay uint8
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for RXTimingSetupReqPayload.
+func (p *RXTimingSetupReqPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 1 {
+		return errors.New("invalid rx timing setup req payload: 1 byte expected")
+	}
+
+	p.Delay = data[0] & 0x0f
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for RXTimingSetupReqPayload.
+func (p *RXTimingSetupReqPayload) Fields() log.Fields {
+	return log.Fields{
+		"delay": p.Delay,
+	}
+}
+
+// TXParamSetupReqPayload is the payload of a TXParamSetupReq command.
+type TXParamSetupReqPayload struct {
+	DownlinkDwellTime bool
+	UplinkDwellTime   bool
+	MaxEIRP           uint8
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for TXParamSetupReqPayload.
+func (p *TXParamSetupReqPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 1 {
+		return errors.New("invalid tx param setup req payload: 1 byte expected")
+	}
+
+	p.DownlinkDwellTime = data[0]&0x20 != 0
+	p.UplinkDwellTime = data[0]&0x10 != 0
+	p.MaxEIRP = data[0] & 0x0f
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for TXParamSetupReqPayload.
+func (p *TXParamSetupReqPayload) Fields() log.Fields {
+	return log.Fields{
+		"downlink dwell time": p.DownlinkDwellTime,
+		"uplink dwell time":   p.UplinkDwellTime,
+		"max eirp":            p.MaxEIRP,
+	}
+}
+
+// DlChannelReqPayload is the payload of a DlChannelReq command.
+type DlChannelReqPayload struct {
+	ChIndex   uint8
+	Frequency uint32
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for DlChannelReqPayload.
+func (p *DlChannelReqPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 4 {
+		return errors.New("invalid dl channel req payload: 4 bytes expected")
+	}
+
+	p.ChIndex = data[0]
+	p.Frequency = frequency(data[1:4])
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for DlChannelReqPayload.
+func (p *DlChannelReqPayload) Fields() log.Fields {
+	return log.Fields{
+		"channel index": p.ChIndex,
+		"frequency":     p.Frequency,
+	}
+}
+
+// DlChannelAnsPayload is the payload of a DlChannelAns command.
+type DlChannelAnsPayload struct {
+	UplinkFrequencyExists bool
+	ChannelFrequencyOK    bool
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for DlChannelAnsPayload.
+func (p *DlChannelAnsPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 1 {
+		return errors.New("invalid dl channel ans payload: 1 byte expected")
+	}
+
+	p.UplinkFrequencyExists = data[0]&0x02 != 0
+	p.ChannelFrequencyOK = data[0]&0x01 != 0
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for DlChannelAnsPayload.
+func (p *DlChannelAnsPayload) Fields() log.Fields {
+	return log.Fields{
+		"uplink frequency exists": p.UplinkFrequencyExists,
+		"channel frequency ok":    p.ChannelFrequencyOK,
+	}
+}
+
+// DeviceTimeAnsPayload is the payload of a DeviceTimeAns command. It
+// contains the time elapsed since the GPS epoch.
+type DeviceTimeAnsPayload struct {
+	TimeSinceGPSEpoch time.Duration
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for DeviceTimeAnsPayload.
+func (p *DeviceTimeAnsPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 5 {
+		return errors.New("invalid device time ans payload: 5 bytes expected")
+	}
+
+	seconds := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24
+	// the fractional second is sent in steps of 1/256 second
+	p.TimeSinceGPSEpoch = time.Duration(seconds)*time.Second + time.Duration(data[4])*time.Second/256
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for DeviceTimeAnsPayload.
+func (p *DeviceTimeAnsPayload) Fields() log.Fields {
+	return log.Fields{
+		"time since gps epoch": p.TimeSinceGPSEpoch.String(),
+	}
+}
+
+// VersionPayload is the payload of the ResetInd, ResetConf, RekeyInd and
+// RekeyConf commands. It contains the minor LoRaWAN version (1 for 1.1).
+type VersionPayload struct {
+	Minor uint8
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for VersionPayload.
+func (p *VersionPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 1 {
+		return errors.New("invalid version payload: 1 byte expected")
+	}
+
+	p.Minor = data[0] & 0x0f
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for VersionPayload.
+func (p *VersionPayload) Fields() log.Fields {
+	return log.Fields{
+		"minor version": p.Minor,
+	}
+}
+
+// ADRParamSetupReqPayload is the payload of an ADRParamSetupReq command.
+// ADR_ACK_LIMIT is 2^LimitExp and ADR_ACK_DELAY is 2^DelayExp.
+type ADRParamSetupReqPayload struct {
+	LimitExp uint8
+	DelayExp uint8
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for ADRParamSetupReqPayload.
+func (p *ADRParamSetupReqPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 1 {
+		return errors.New("invalid adr param setup req payload: 1 byte expected")
+	}
+
+	p.LimitExp = data[0] >> 4
+	p.DelayExp = data[0] & 0x0f
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for ADRParamSetupReqPayload.
+func (p *ADRParamSetupReqPayload) Fields() log.Fields {
+	return log.Fields{
+		"adr ack limit": 1 << p.LimitExp,
+		"adr ack delay": 1 << p.DelayExp,
+	}
+}
+
+// ForceRejoinReqPayload is the payload of a ForceRejoinReq command.
+type ForceRejoinReqPayload struct {
+	Period     uint8
+	MaxRetries uint8
+	RejoinType uint8
+	DR         uint8
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for ForceRejoinReqPayload.
+func (p *ForceRejoinReqPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 2 {
+		return errors.New("invalid force rejoin req payload: 2 bytes expected")
+	}
+
+	v := uint16(data[0]) | uint16(data[1])<<8
+	p.Period = uint8(v>>11) & 0x07
+	p.MaxRetries = uint8(v>>8) & 0x07
+	p.RejoinType = uint8(v>>4) & 0x07
+	p.DR = uint8(v) & 0x0f
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for ForceRejoinReqPayload.
+func (p *ForceRejoinReqPayload) Fields() log.Fields {
+	return log.Fields{
+		"period":      p.Period,
+		"max retries": p.MaxRetries,
+		"rejoin type": p.RejoinType,
+		"data rate":   p.DR,
+	}
+}
+
+// RejoinParamSetupReqPayload is the payload of a RejoinParamSetupReq
+// command. A rejoin-request is sent every 2^(MaxTimeN+10) seconds or every
+// 2^(MaxCountN+4) uplinks.
+type RejoinParamSetupReqPayload struct {
+	MaxTimeN  uint8
+	MaxCountN uint8
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for RejoinParamSetupReqPayload.
+func (p *RejoinParamSetupReqPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 1 {
+		return errors.New("invalid rejoin param setup req payload: 1 byte expected")
+	}
+
+	p.MaxTimeN = data[0] >> 4
+	p.MaxCountN = data[0] & 0x0f
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for RejoinParamSetupReqPayload.
+func (p *RejoinParamSetupReqPayload) Fields() log.Fields {
+	return log.Fields{
+		"max time n":  p.MaxTimeN,
+		"max count n": p.MaxCountN,
+	}
+}
+
+// RejoinParamSetupAnsPayload is the payload of a RejoinParamSetupAns command.
+type RejoinParamSetupAnsPayload struct {
+	TimeOK bool
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for RejoinParamSetupAnsPayload.
+func (p *RejoinParamSetupAnsPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 1 {
+		return errors.New("invalid rejoin param setup ans payload: 1 byte expected")
+	}
+
+	p.TimeOK = data[0]&0x01 != 0
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for RejoinParamSetupAnsPayload.
+func (p *RejoinParamSetupAnsPayload) Fields() log.Fields {
+	return log.Fields{
+		"time ok": p.TimeOK,
+	}
+}
+
+// PingSlotInfoReqPayload is the payload of a PingSlotInfoReq command. The
+// end-device opens a ping slot every 2^Periodicity seconds.
+type PingSlotInfoReqPayload struct {
+	Periodicity uint8
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for PingSlotInfoReqPayload.
+func (p *PingSlotInfoReqPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 1 {
+		return errors.New("invalid ping slot info req payload: 1 byte expected")
+	}
+
+	p.Periodicity = data[0] & 0x07
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for PingSlotInfoReqPayload.
+func (p *PingSlotInfoReqPayload) Fields() log.Fields {
+	return log.Fields{
+		"periodicity": p.Periodicity,
+	}
+}
+
+// PingSlotChannelReqPayload is the payload of a PingSlotChannelReq command.
+// A frequency of 0 restores the default ping slot frequency.
+type PingSlotChannelReqPayload struct {
+	Frequency uint32
+	DataRate  uint8
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for PingSlotChannelReqPayload.
+func (p *PingSlotChannelReqPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 4 {
+		return errors.New("invalid ping slot channel req payload: 4 bytes expected")
+	}
+
+	p.Frequency = frequency(data[0:3])
+	p.DataRate = data[3] & 0x0f
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for PingSlotChannelReqPayload.
+func (p *PingSlotChannelReqPayload) Fields() log.Fields {
+	return log.Fields{
+		"frequency": p.Frequency,
+		"data rate": p.DataRate,
+	}
+}
+
+// PingSlotChannelAnsPayload is the payload of a PingSlotChannelAns command.
+type PingSlotChannelAnsPayload struct {
+	DataRateOK         bool
+	ChannelFrequencyOK bool
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for PingSlotChannelAnsPayload.
+func (p *PingSlotChannelAnsPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 1 {
+		return errors.New("invalid ping slot channel ans payload: 1 byte expected")
+	}
+
+	p.DataRateOK = data[0]&0x02 != 0
+	p.ChannelFrequencyOK = data[0]&0x01 != 0
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for PingSlotChannelAnsPayload.
+func (p *PingSlotChannelAnsPayload) Fields() log.Fields {
+	return log.Fields{
+		"data rate ok":         p.DataRateOK,
+		"channel frequency ok": p.ChannelFrequencyOK,
+	}
+}
+
+// BeaconTimingAnsPayload is the payload of a BeaconTimingAns command, it was
+// removed in LoRaWAN 1.0.3 in favour of DeviceTime. The next beacon is sent
+// after Delay times 30 ms on the given beacon channel.
+type BeaconTimingAnsPayload struct {
+	Delay   uint16
+	Channel uint8
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for BeaconTimingAnsPayload.
+func (p *BeaconTimingAnsPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 3 {
+		return errors.New("invalid beacon timing ans payload: 3 bytes expected")
+	}
+
+	p.Delay = uint16(data[0]) | uint16(data[1])<<8
+	p.Channel = data[2]
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for BeaconTimingAnsPayload.
+func (p *BeaconTimingAnsPayload) Fields() log.Fields {
+	return log.Fields{
+		"delay":   (time.Duration(p.Delay) * 30 * time.Millisecond).String(),
+		"channel": p.Channel,
+	}
+}
+
+// BeaconFreqReqPayload is the payload of a BeaconFreqReq command. A frequency
+// of 0 restores the default beacon frequency.
+type BeaconFreqReqPayload struct {
+	Frequency uint32
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for BeaconFreqReqPayload.
+func (p *BeaconFreqReqPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 3 {
+		return errors.New("invalid beacon freq req payload: 3 bytes expected")
+	}
+
+	p.Frequency = frequency(data)
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for BeaconFreqReqPayload.
+func (p *BeaconFreqReqPayload) Fields() log.Fields {
+	return log.Fields{
+		"frequency": p.Frequency,
+	}
+}
+
+// BeaconFreqAnsPayload is the payload of a BeaconFreqAns command.
+type BeaconFreqAnsPayload struct {
+	BeaconFrequencyOK bool
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for BeaconFreqAnsPayload.
+func (p *BeaconFreqAnsPayload) UnmarshalBinary(data []byte) error {
+	if len(data) != 1 {
+		return errors.New("invalid beacon freq ans payload: 1 byte expected")
+	}
+
+	p.BeaconFrequencyOK = data[0]&0x01 != 0
+
+	return nil
+}
+
+// Fields implements the MACCommandPayload interface for BeaconFreqAnsPayload.
+func (p *BeaconFreqAnsPayload) Fields() log.Fields {
+	return log.Fields{
+		"beacon frequency ok": p.BeaconFrequencyOK,
+	}
+}
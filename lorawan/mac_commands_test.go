@@ -0,0 +1,96 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lorawan
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeMACCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		uplink   bool
+		data     string
+		commands []MACCommand
+		err      string
+	}{
+		{"uplink", true, "02030706FF3E0B011003110312" + "1301", []MACCommand{
+			{LinkCheck, true, nil},
+			{LinkADR, true, &LinkADRAnsPayload{PowerACK: true, DataRateACK: true, ChannelMaskACK: true}},
+			{DevStatus, true, &DevStatusAnsPayload{Battery: 255, Margin: -2}},
+			{Rekey, true, &VersionPayload{Minor: 1}},
+			{PingSlotInfo, true, &PingSlotInfoReqPayload{Periodicity: 3}},
+			{PingSlotChannel, true, &PingSlotChannelAnsPayload{DataRateOK: true, ChannelFrequencyOK: true}},
+			{BeaconTiming, true, nil},
+			{BeaconFreq, true, &BeaconFreqAnsPayload{BeaconFrequencyOK: true}},
+		}, ""},
+		{"downlink", false, "020502035207006106" + "11D2AD8403120A000113D2AD84", []MACCommand{
+			{LinkCheck, false, &LinkCheckAnsPayload{Margin: 5, GwCnt: 2}},
+			{LinkADR, false, &LinkADRReqPayload{DataRate: 5, TXPower: 2, ChMask: 0x0007, ChMaskCntl: 6, NbTrans: 1}},
+			{DevStatus, false, nil},
+			{PingSlotChannel, false, &PingSlotChannelReqPayload{Frequency: 869525000, DataRate: 3}},
+			{BeaconTiming, false, &BeaconTimingAnsPayload{Delay: 10, Channel: 1}},
+			{BeaconFreq, false, &BeaconFreqReqPayload{Frequency: 869525000}},
+		}, ""},
+		{"unknown CID", true, "02800102", []MACCommand{
+			{LinkCheck, true, nil},
+		}, "unknown mac command: CID 0x80, 800102 undecoded"},
+		{"truncated payload", false, "060203", []MACCommand{
+			{DevStatus, false, nil},
+		}, "invalid mac command LinkCheckAns: 2 bytes expected, 0203 undecoded"},
+		{"downlink command in uplink", true, "0E0102", nil, "unknown mac command: CID 0x0E, 0E0102 undecoded"},
+	}
+
+	for _, test := range tests {
+		commands, err := DecodeMACCommands(test.uplink, mustDecodeHex(t, test.data))
+		if len(test.err) == 0 && err != nil {
+			t.Errorf("%s: decode failed: %v", test.name, err)
+		}
+		if len(test.err) > 0 && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: error %v, expected %q", test.name, err, test.err)
+		}
+		if !reflect.DeepEqual(commands, test.commands) {
+			t.Errorf("%s: decoded %+v, expected %+v", test.name, commands, test.commands)
+		}
+	}
+}
+
+func TestMACCommandName(t *testing.T) {
+	tests := []struct {
+		command MACCommand
+		name    string
+	}{
+		{MACCommand{CID: LinkADR, Uplink: false}, "LinkADRReq"},
+		{MACCommand{CID: LinkADR, Uplink: true}, "LinkADRAns"},
+		{MACCommand{CID: PingSlotInfo, Uplink: true}, "PingSlotInfoReq"},
+		{MACCommand{CID: 0x80, Uplink: true}, "CID(0x80)"},
+	}
+
+	for _, test := range tests {
+		if name := test.command.Name(); name != test.name {
+			t.Errorf("name %q, expected %q", name, test.name)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lorawan
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+)
+
+// DevAddr is the 32 bit address of an end-device in the network.
+type DevAddr [4]byte
+
+// String implements the stringer interface for DevAddr.
+func (a DevAddr) String() string {
+	return fmt.Sprintf("%X", a[:])
+}
+
+// MarshalText implements the encoding.TextMarshaler interface for DevAddr.
+func (a DevAddr) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface for DevAddr.
+func (a *DevAddr) UnmarshalText(text []byte) error {
+	return decodeHex(a[:], text)
+}
+
+// FCtrl is the frame control octet of the frame header. The ADRACKReq and
+// ClassB bits are only used in uplink, FPending only in downlink.
+type FCtrl struct {
+	ADR       bool
+	ADRACKReq bool
+	ACK       bool
+	ClassB    bool
+	FPending  bool
+	FOptsLen  uint8
+}
+
+// FHDR is the frame header.
+type FHDR struct {
+	DevAddr DevAddr
+	FCtrl   FCtrl
+	FCnt    uint16
+	FOpts   []byte
+}
+
+// MACPayload is the payload of a data message. FRMPayload is encrypted
+// unless Decrypted is set. FOptsEncrypted is set when the frame is known to
+// be LoRaWAN 1.1 but its FOpts were not decrypted, the frame itself does not
+// tell the version.
+type MACPayload struct {
+	FHDR           FHDR
+	FPort          *uint8
+	FRMPayload     []byte
+	Decrypted      bool
+	FOptsEncrypted bool
+
+	uplink bool
+}
+
+// Uplink returns true when the payload was sent by the end-device.
+func (p *MACPayload) Uplink() bool {
+	return p.uplink
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for MACPayload.
+func (p *MACPayload) UnmarshalBinary(data []byte) error {
+	if len(data) < 7 {
+		return errors.New("invalid mac payload: at least 7 bytes expected")
+	}
+
+	// DevAddr is sent little endian
+	for i := 0; i < 4; i++ {
+		p.FHDR.DevAddr[i] = data[3-i]
+	}
+
+	fCtrl := data[4]
+	p.FHDR.FCtrl.ADR = fCtrl&0x80 != 0
+	p.FHDR.FCtrl.ACK = fCtrl&0x20 != 0
+	p.FHDR.FCtrl.FOptsLen = fCtrl & 0x0f
+	if p.uplink {
+		p.FHDR.FCtrl.ADRACKReq = fCtrl&0x40 != 0
+		p.FHDR.FCtrl.ClassB = fCtrl&0x10 != 0
+	} else {
+		p.FHDR.FCtrl.FPending = fCtrl&0x10 != 0
+	}
+
+	p.FHDR.FCnt = binary.LittleEndian.Uint16(data[5:7])
+
+	fOptsEnd := 7 + int(p.FHDR.FCtrl.FOptsLen)
+	if len(data) < fOptsEnd {
+		return errors.New("invalid mac payload: fopts length exceeds payload")
+	}
+	p.FHDR.FOpts = append([]byte(nil), data[7:fOptsEnd]...)
+
+	p.FPort = nil
+	p.FRMPayload = nil
+	if len(data) > fOptsEnd {
+		fPort := data[fOptsEnd]
+		p.FPort = &fPort
+		p.FRMPayload = append([]byte(nil), data[fOptsEnd+1:]...)
+	}
+
+	return nil
+}
+
+// MACCommands decodes the MAC commands piggybacked in FOpts, or sent as
+// FRMPayload on port 0. The latter are only decoded once FRMPayload is
+// decrypted, encrypted LoRaWAN 1.1 FOpts are not decoded.
+func (p *MACPayload) MACCommands() ([]MACCommand, error) {
+	if p.FPort != nil && *p.FPort == 0 {
+		if !p.Decrypted {
+			return nil, nil
+		}
+		return DecodeMACCommands(p.uplink, p.FRMPayload)
+	}
+
+	if p.FOptsEncrypted {
+		return nil, nil
+	}
+	return DecodeMACCommands(p.uplink, p.FHDR.FOpts)
+}
+
+// Fields implements the Payload interface for MACPayload.
+func (p *MACPayload) Fields() log.Fields {
+	fields := log.Fields{
+		"device address": p.FHDR.DevAddr,
+		"adr":            p.FHDR.FCtrl.ADR,
+		"ack":            p.FHDR.FCtrl.ACK,
+		"fopts length":   p.FHDR.FCtrl.FOptsLen,
+		"frame counter":  p.FHDR.FCnt,
+	}
+
+	if p.uplink {
+		fields["adr ack request"] = p.FHDR.FCtrl.ADRACKReq
+		fields["class b"] = p.FHDR.FCtrl.ClassB
+	} else {
+		fields["frame pending"] = p.FHDR.FCtrl.FPending
+	}
+
+	if len(p.FHDR.FOpts) > 0 {
+		fields["fopts"] = fmt.Sprintf("%X", p.FHDR.FOpts)
+		if p.FOptsEncrypted {
+			fields["fopts encrypted"] = true
+		}
+	}
+
+	if p.FPort != nil {
+		fields["port"] = *p.FPort
+		fields["frm payload"] = fmt.Sprintf("%X", p.FRMPayload)
+		fields["decrypted"] = p.Decrypted
+	}
+
+	commands, err := p.MACCommands()
+	if len(commands) > 0 {
+		fields["mac commands"] = macCommandsFields(commands)
+	}
+	if err != nil {
+		fields["mac commands error"] = err.Error()
+	}
+
+	return fields
+}
@@ -0,0 +1,194 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:generate stringer -type=MType
+
+// Package lorawan decodes the LoRaWAN PHYPayload carried in the data field
+// of the packets sent by and to a packet forwarder.
+package lorawan
+
+import (
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+)
+
+// MType defines the message type.
+type MType byte
+
+// Available message types
+const (
+	JoinRequest MType = iota
+	JoinAccept
+	UnconfirmedDataUp
+	UnconfirmedDataDown
+	ConfirmedDataUp
+	ConfirmedDataDown
+	RejoinRequest
+	Proprietary
+)
+
+// IsUplink returns true when the message is sent by the end-device.
+func (m MType) IsUplink() bool {
+	switch m {
+	case JoinRequest, UnconfirmedDataUp, ConfirmedDataUp, RejoinRequest:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsData returns true when the message carries a MACPayload.
+func (m MType) IsData() bool {
+	switch m {
+	case UnconfirmedDataUp, UnconfirmedDataDown, ConfirmedDataUp, ConfirmedDataDown:
+		return true
+	default:
+		return false
+	}
+}
+
+// Major defines the major version of the data message format.
+type Major byte
+
+// Available major versions
+const (
+	LoRaWANR1 Major = 0x00
+)
+
+// MHDR is the MAC header, it specifies the message type and the major
+// version of the frame format.
+type MHDR struct {
+	MType MType
+	Major Major
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface for MHDR.
+func (h MHDR) MarshalBinary() ([]byte, error) {
+	return []byte{byte(h.MType)<<5 | byte(h.Major)&0x03}, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for MHDR.
+func (h *MHDR) UnmarshalBinary(data []byte) error {
+	if len(data) != 1 {
+		return errors.New("invalid mhdr: 1 byte expected")
+	}
+
+	h.MType = MType(data[0] >> 5)
+	h.Major = Major(data[0] & 0x03)
+
+	return nil
+}
+
+// Payload is implemented by the different message payloads.
+type Payload interface {
+	// Fields returns the decoded payload as log fields.
+	Fields() log.Fields
+}
+
+// RawPayload contains a payload that is not decoded (eg. proprietary
+// messages).
+type RawPayload []byte
+
+// Fields implements the Payload interface for RawPayload.
+func (p RawPayload) Fields() log.Fields {
+	return log.Fields{
+		"payload": fmt.Sprintf("%X", []byte(p)),
+	}
+}
+
+// PHYPayload is the physical payload of a LoRaWAN frame.
+type PHYPayload struct {
+	MHDR    MHDR
+	Payload Payload
+	MIC     [4]byte
+
+	// raw contains the frame as received, it is needed to compute the MIC
+	raw []byte
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for PHYPayload.
+func (p *PHYPayload) UnmarshalBinary(data []byte) error {
+	if len(data) < 5 {
+		return errors.New("invalid phy payload: at least 5 bytes expected")
+	}
+
+	err := p.MHDR.UnmarshalBinary(data[0:1])
+	if err != nil {
+		return errors.Wrap(err, "unmarshal phy payload failed")
+	}
+
+	p.raw = append([]byte(nil), data...)
+	payload := data[1 : len(data)-4]
+	copy(p.MIC[:], data[len(data)-4:])
+
+	switch {
+	case p.MHDR.MType.IsData():
+		macPayload := MACPayload{uplink: p.MHDR.MType.IsUplink()}
+		err = macPayload.UnmarshalBinary(payload)
+		if err != nil {
+			return errors.Wrap(err, "unmarshal phy payload failed")
+		}
+		p.Payload = &macPayload
+	case p.MHDR.MType == JoinRequest:
+		var joinRequestPayload JoinRequestPayload
+		err = joinRequestPayload.UnmarshalBinary(payload)
+		if err != nil {
+			return errors.Wrap(err, "unmarshal phy payload failed")
+		}
+		p.Payload = &joinRequestPayload
+	case p.MHDR.MType == RejoinRequest:
+		var rejoinRequestPayload RejoinRequestPayload
+		err = rejoinRequestPayload.UnmarshalBinary(payload)
+		if err != nil {
+			return errors.Wrap(err, "unmarshal phy payload failed")
+		}
+		p.Payload = &rejoinRequestPayload
+	case p.MHDR.MType == JoinAccept:
+		p.Payload = &JoinAcceptPayload{
+			Encrypted:  true,
+			ciphertext: append([]byte(nil), data[1:]...),
+		}
+	default:
+		p.Payload = RawPayload(append([]byte(nil), payload...))
+	}
+
+	return nil
+}
+
+// Fields returns the decoded frame as log fields.
+func (p *PHYPayload) Fields() log.Fields {
+	fields := log.Fields{
+		"message type": p.MHDR.MType.String(),
+		"major":        p.MHDR.Major,
+		"mic":          fmt.Sprintf("%X", p.MIC),
+	}
+
+	if p.Payload != nil {
+		for k, v := range p.Payload.Fields() {
+			fields[k] = v
+		}
+	}
+
+	return fields
+}
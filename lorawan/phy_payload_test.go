@@ -0,0 +1,148 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lorawan
+
+import (
+	"bytes"
+	"testing"
+)
+
+// loraPacketFrame is the unconfirmed data up frame of the lora-packet
+// examples, FRMPayload "test" on port 1 encrypted with loraPacketAppSKey and
+// signed with loraPacketNwkSKey.
+const (
+	loraPacketFrame   = "40F17DBE4900020001954378762B11FF0D"
+	loraPacketNwkSKey = "44024241ED4CE9A68C6A8BC055233FD3"
+	loraPacketAppSKey = "EC925802AE430CA77FD3DD73CB2CC588"
+)
+
+func TestPHYPayloadUnmarshalBinary(t *testing.T) {
+	var phy PHYPayload
+	if err := phy.UnmarshalBinary(mustDecodeHex(t, loraPacketFrame)); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+
+	if phy.MHDR.MType != UnconfirmedDataUp || phy.MHDR.Major != LoRaWANR1 {
+		t.Errorf("mhdr %+v, expected unconfirmed data up", phy.MHDR)
+	}
+	if want := [4]byte{0x2B, 0x11, 0xFF, 0x0D}; phy.MIC != want {
+		t.Errorf("mic %X, expected %X", phy.MIC, want)
+	}
+
+	macPayload, ok := phy.Payload.(*MACPayload)
+	if !ok {
+		t.Fatalf("payload %T, expected *MACPayload", phy.Payload)
+	}
+	if !macPayload.Uplink() {
+		t.Error("uplink expected")
+	}
+	if want := (DevAddr{0x49, 0xBE, 0x7D, 0xF1}); macPayload.FHDR.DevAddr != want {
+		t.Errorf("device address %s, expected %s", macPayload.FHDR.DevAddr, want)
+	}
+	if macPayload.FHDR.FCtrl != (FCtrl{}) {
+		t.Errorf("fctrl %+v, expected none set", macPayload.FHDR.FCtrl)
+	}
+	if macPayload.FHDR.FCnt != 2 {
+		t.Errorf("frame counter %d, expected 2", macPayload.FHDR.FCnt)
+	}
+	if macPayload.FPort == nil || *macPayload.FPort != 1 {
+		t.Errorf("port %v, expected 1", macPayload.FPort)
+	}
+	if want := mustDecodeHex(t, "95437876"); !bytes.Equal(macPayload.FRMPayload, want) {
+		t.Errorf("frm payload %X, expected %X", macPayload.FRMPayload, want)
+	}
+	if macPayload.Decrypted {
+		t.Error("frm payload decrypted without keys")
+	}
+}
+
+func TestPHYPayloadDataMICAndDecrypt(t *testing.T) {
+	var phy PHYPayload
+	if err := phy.UnmarshalBinary(mustDecodeHex(t, loraPacketFrame)); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	nwkSKey := mustKey(t, loraPacketNwkSKey)
+	appSKey := mustKey(t, loraPacketAppSKey)
+
+	ok, err := phy.ValidateDataMIC(nwkSKey)
+	if err != nil || !ok {
+		t.Errorf("mic not valid: %v", err)
+	}
+	ok, err = phy.ValidateDataMIC(appSKey)
+	if err != nil || ok {
+		t.Errorf("mic valid with the wrong key: %v", err)
+	}
+
+	if err := phy.DecryptFRMPayload(nwkSKey, appSKey); err != nil {
+		t.Fatalf("decrypt failed: %v", err)
+	}
+	macPayload := phy.Payload.(*MACPayload)
+	if !macPayload.Decrypted || string(macPayload.FRMPayload) != "test" {
+		t.Errorf("frm payload %q, expected \"test\"", macPayload.FRMPayload)
+	}
+}
+
+func TestPHYPayloadUnmarshalBinaryFrames(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame string
+		mType MType
+		valid bool
+	}{
+		{"downlink with fopts", "A0F17DBE49B50300030201000011223344", ConfirmedDataDown, true},
+		{"uplink without port", "80F17DBE4900030001020304", ConfirmedDataUp, true},
+		{"proprietary", "E0010203040506", Proprietary, true},
+		{"join accept", "204D675A1AAE1F98C3F95A4A62E0A32D33", JoinAccept, true},
+		{"too short", "40010203", 0, false},
+		{"fopts beyond payload", "40F17DBE490F0200AABBCCDD", 0, false},
+		{"join request of wrong size", "00010203040506070801020304050607", 0, false},
+	}
+
+	for _, test := range tests {
+		var phy PHYPayload
+		err := phy.UnmarshalBinary(mustDecodeHex(t, test.frame))
+		if (err == nil) != test.valid {
+			t.Errorf("%s: decode returned %v", test.name, err)
+			continue
+		}
+		if err == nil && phy.MHDR.MType != test.mType {
+			t.Errorf("%s: message type %s, expected %s", test.name, phy.MHDR.MType, test.mType)
+		}
+	}
+
+	var phy PHYPayload
+	if err := phy.UnmarshalBinary(mustDecodeHex(t, "A0F17DBE49B50300030201000011223344")); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	macPayload := phy.Payload.(*MACPayload)
+	fCtrl := macPayload.FHDR.FCtrl
+	if !fCtrl.ADR || !fCtrl.ACK || !fCtrl.FPending || fCtrl.ClassB || fCtrl.FOptsLen != 5 {
+		t.Errorf("fctrl %+v, expected adr, ack and frame pending with 5 bytes of fopts", fCtrl)
+	}
+	if want := mustDecodeHex(t, "0302010000"); !bytes.Equal(macPayload.FHDR.FOpts, want) {
+		t.Errorf("fopts %X, expected %X", macPayload.FHDR.FOpts, want)
+	}
+	if macPayload.FHDR.FCnt != 3 {
+		t.Errorf("frame counter %d, expected 3", macPayload.FHDR.FCnt)
+	}
+}
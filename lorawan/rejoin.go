@@ -0,0 +1,108 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lorawan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+)
+
+// RejoinRequestPayload is the payload of a LoRaWAN 1.1 rejoin-request. Type
+// 0 and 2 carry the NetID, type 1 the JoinEUI.
+type RejoinRequestPayload struct {
+	RejoinType uint8
+	NetID      [3]byte
+	JoinEUI    EUI64
+	DevEUI     EUI64
+	RJCount    uint16
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for RejoinRequestPayload.
+func (p *RejoinRequestPayload) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 {
+		return errors.New("invalid rejoin request payload: at least 1 byte expected")
+	}
+
+	p.RejoinType = data[0]
+
+	switch p.RejoinType {
+	case 0, 2:
+		if len(data) != 14 {
+			return errors.New("invalid rejoin request payload: 14 bytes expected")
+		}
+		copy(p.NetID[:], reverse(data[1:4]))
+		copy(p.DevEUI[:], reverse(data[4:12]))
+		p.RJCount = binary.LittleEndian.Uint16(data[12:14])
+	case 1:
+		if len(data) != 19 {
+			return errors.New("invalid rejoin request payload: 19 bytes expected")
+		}
+		copy(p.JoinEUI[:], reverse(data[1:9]))
+		copy(p.DevEUI[:], reverse(data[9:17]))
+		p.RJCount = binary.LittleEndian.Uint16(data[17:19])
+	default:
+		return errors.New(fmt.Sprintf("invalid rejoin request payload: unknown rejoin type %d", p.RejoinType))
+	}
+
+	return nil
+}
+
+// Fields implements the Payload interface for RejoinRequestPayload.
+func (p *RejoinRequestPayload) Fields() log.Fields {
+	fields := log.Fields{
+		"rejoin type":  p.RejoinType,
+		"dev eui":      p.DevEUI,
+		"rejoin count": p.RJCount,
+	}
+
+	if p.RejoinType == 1 {
+		fields["join eui"] = p.JoinEUI
+	} else {
+		fields["net id"] = fmt.Sprintf("%X", p.NetID)
+	}
+
+	return fields
+}
+
+// ValidateRejoinRequestMIC checks the MIC of a rejoin-request. Type 0 and 2
+// are signed with the SNwkSIntKey, type 1 with the JSIntKey derived from the
+// NwkKey.
+func (p *PHYPayload) ValidateRejoinRequestMIC(sNwkSIntKey, nwkKey AES128Key) (bool, error) {
+	payload, ok := p.Payload.(*RejoinRequestPayload)
+	if !ok {
+		return false, errors.New("validate rejoin request mic failed: no rejoin request payload")
+	}
+
+	key := sNwkSIntKey
+	if payload.RejoinType == 1 {
+		key = deriveJSKey(nwkKey, 0x06, payload.DevEUI)
+	}
+
+	mic := cmac(key, p.raw[:len(p.raw)-4])
+
+	return bytes.Equal(mic[:4], p.MIC[:]), nil
+}
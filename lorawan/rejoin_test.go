@@ -0,0 +1,106 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package lorawan
+
+import (
+	"testing"
+)
+
+// The rejoin-request vectors follow section 6.2.4 of the LoRaWAN 1.1
+// specification, their MIC was computed with the OpenSSL CMAC
+// implementation. Device 0004A30B001C0531 sends a type 0 rejoin to NetID
+// 000013 signed with session11SNwkSIntKey and a type 1 rejoin to JoinEUI
+// 70B3D57ED0000000 signed with the JSIntKey of rejoinNwkKey.
+const (
+	rejoinNwkKey   = "606162636465666768696A6B6C6D6E6F"
+	rejoinRequest0 = "C00013000031051C000BA3040001003EFD3FFA"
+	rejoinRequest1 = "C001000000D07ED5B37031051C000BA30400020063B2DBAB"
+)
+
+func TestRejoinRequest(t *testing.T) {
+	devEUI := EUI64{0x00, 0x04, 0xA3, 0x0B, 0x00, 0x1C, 0x05, 0x31}
+
+	tests := []struct {
+		name    string
+		frame   string
+		payload RejoinRequestPayload
+	}{
+		{"type 0", rejoinRequest0, RejoinRequestPayload{
+			RejoinType: 0,
+			NetID:      [3]byte{0x00, 0x00, 0x13},
+			DevEUI:     devEUI,
+			RJCount:    1,
+		}},
+		{"type 1", rejoinRequest1, RejoinRequestPayload{
+			RejoinType: 1,
+			JoinEUI:    EUI64{0x70, 0xB3, 0xD5, 0x7E, 0xD0, 0x00, 0x00, 0x00},
+			DevEUI:     devEUI,
+			RJCount:    2,
+		}},
+	}
+
+	sNwkSIntKey := mustKey(t, session11SNwkSIntKey)
+	nwkKey := mustKey(t, rejoinNwkKey)
+
+	for _, test := range tests {
+		var phy PHYPayload
+		if err := phy.UnmarshalBinary(mustDecodeHex(t, test.frame)); err != nil {
+			t.Errorf("%s: decode failed: %v", test.name, err)
+			continue
+		}
+		payload, ok := phy.Payload.(*RejoinRequestPayload)
+		if !ok {
+			t.Errorf("%s: payload %T, expected *RejoinRequestPayload", test.name, phy.Payload)
+			continue
+		}
+		if *payload != test.payload {
+			t.Errorf("%s: rejoin request %+v, expected %+v", test.name, *payload, test.payload)
+		}
+
+		ok, err := phy.ValidateRejoinRequestMIC(sNwkSIntKey, nwkKey)
+		if err != nil || !ok {
+			t.Errorf("%s: mic not valid: %v", test.name, err)
+		}
+		ok, err = phy.ValidateRejoinRequestMIC(nwkKey, sNwkSIntKey)
+		if err != nil || ok {
+			t.Errorf("%s: mic valid with the wrong keys: %v", test.name, err)
+		}
+	}
+}
+
+func TestRejoinRequestUnmarshalBinaryInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame string
+	}{
+		{"type 0 too short", "C000130000310500000000"},
+		{"type 1 too short", "C001000000D07ED5B37031051C000BA3040002000000"},
+		{"unknown type", "C00313000031051C000BA3040001003EFD3FFA"},
+	}
+
+	for _, test := range tests {
+		var phy PHYPayload
+		if err := phy.UnmarshalBinary(mustDecodeHex(t, test.frame)); err == nil {
+			t.Errorf("%s: decoded %+v, expected an error", test.name, phy.Payload)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lorawan
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// dataBlock returns the B0 (MIC) or A (encryption) block of a data message.
+// The frame counter is 32 bit, but only the 16 least significant bits are
+// sent over the air, the most significant bits are assumed to be zero.
+func (p *MACPayload) dataBlock(first byte, last byte) []byte {
+	b := make([]byte, 16)
+	b[0] = first
+	if !p.uplink {
+		b[5] = 0x01
+	}
+	copy(b[6:10], reverse(p.FHDR.DevAddr[:]))
+	binary.LittleEndian.PutUint32(b[10:14], uint32(p.FHDR.FCnt))
+	b[15] = last
+	return b
+}
+
+// ValidateDataMIC checks the MIC of a data message with the NwkSKey.
+func (p *PHYPayload) ValidateDataMIC(nwkSKey AES128Key) (bool, error) {
+	macPayload, ok := p.Payload.(*MACPayload)
+	if !ok {
+		return false, errors.New("validate data mic failed: no mac payload")
+	}
+
+	msg := p.raw[:len(p.raw)-4]
+	b0 := macPayload.dataBlock(0x49, byte(len(msg)))
+	mic := cmac(nwkSKey, append(b0, msg...))
+
+	return bytes.Equal(mic[:4], p.MIC[:]), nil
+}
+
+// ValidateDataMIC11 checks the MIC of a LoRaWAN 1.1 data message. Uplinks
+// carry two MIC halves, the FNwkSIntKey half is always verified, the
+// SNwkSIntKey half only when the data rate and channel are known.
+func (p *PHYPayload) ValidateDataMIC11(keys SessionKeys, opts MICOptions) (bool, error) {
+	macPayload, ok := p.Payload.(*MACPayload)
+	if !ok {
+		return false, errors.New("validate data mic failed: no mac payload")
+	}
+
+	msg := p.raw[:len(p.raw)-4]
+	b0 := macPayload.dataBlock(0x49, byte(len(msg)))
+
+	if !macPayload.uplink {
+		binary.LittleEndian.PutUint16(b0[1:3], opts.ConfFCnt)
+		mic := cmac(keys.SNwkSIntKey, append(b0, msg...))
+		return bytes.Equal(mic[:4], p.MIC[:]), nil
+	}
+
+	cmacF := cmac(keys.FNwkSIntKey, append(b0, msg...))
+	if !bytes.Equal(cmacF[:2], p.MIC[2:4]) {
+		return false, nil
+	}
+
+	if opts.TxDR == nil || opts.TxCh == nil {
+		return true, nil
+	}
+
+	b1 := macPayload.dataBlock(0x49, byte(len(msg)))
+	binary.LittleEndian.PutUint16(b1[1:3], opts.ConfFCnt)
+	b1[3] = *opts.TxDR
+	b1[4] = *opts.TxCh
+	cmacS := cmac(keys.SNwkSIntKey, append(b1, msg...))
+
+	return bytes.Equal(cmacS[:2], p.MIC[0:2]), nil
+}
+
+// DecryptFOpts decrypts the FOpts of a LoRaWAN 1.1 data message with the
+// NwkSEncKey. LoRaWAN 1.0.x sends FOpts unencrypted.
+func (p *PHYPayload) DecryptFOpts(nwkSEncKey AES128Key) error {
+	macPayload, ok := p.Payload.(*MACPayload)
+	if !ok {
+		return errors.New("decrypt fopts failed: no mac payload")
+	}
+
+	if len(macPayload.FHDR.FOpts) == 0 {
+		return nil
+	}
+
+	s := make([]byte, 16)
+	newCipher(nwkSEncKey).Encrypt(s, macPayload.dataBlock(0x01, 0x00))
+	for i := range macPayload.FHDR.FOpts {
+		macPayload.FHDR.FOpts[i] ^= s[i]
+	}
+	macPayload.FOptsEncrypted = false
+
+	return nil
+}
+
+// ValidateJoinRequestMIC checks the MIC of a join-request with the AppKey.
+func (p *PHYPayload) ValidateJoinRequestMIC(appKey AES128Key) (bool, error) {
+	if _, ok := p.Payload.(*JoinRequestPayload); !ok {
+		return false, errors.New("validate join request mic failed: no join request payload")
+	}
+
+	mic := cmac(appKey, p.raw[:len(p.raw)-4])
+
+	return bytes.Equal(mic[:4], p.MIC[:]), nil
+}
+
+// DecryptFRMPayload decrypts the FRMPayload of a data message. Port 0
+// carries MAC commands and is encrypted with the NwkSKey (NwkSEncKey in
+// LoRaWAN 1.1), all other ports with the AppSKey.
+func (p *PHYPayload) DecryptFRMPayload(nwkSKey, appSKey AES128Key) error {
+	macPayload, ok := p.Payload.(*MACPayload)
+	if !ok {
+		return errors.New("decrypt frm payload failed: no mac payload")
+	}
+
+	if macPayload.Decrypted || macPayload.FPort == nil {
+		return nil
+	}
+
+	key := appSKey
+	if *macPayload.FPort == 0 {
+		key = nwkSKey
+	}
+
+	macPayload.FRMPayload = macPayload.cipher(key, macPayload.FRMPayload)
+	macPayload.Decrypted = true
+
+	return nil
+}
+
+// cipher encrypts or decrypts data, the operation is symmetric.
+func (p *MACPayload) cipher(key AES128Key, data []byte) []byte {
+	block := newCipher(key)
+	out := make([]byte, len(data))
+	s := make([]byte, 16)
+
+	for i := 0; i < len(data); i += 16 {
+		a := p.dataBlock(0x01, byte(i/16+1))
+		block.Encrypt(s, a)
+		for j := i; j < i+16 && j < len(data); j++ {
+			out[j] = data[j] ^ s[j-i]
+		}
+	}
+
+	return out
+}
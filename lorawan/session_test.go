@@ -0,0 +1,128 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package lorawan
+
+import (
+	"bytes"
+	"testing"
+)
+
+// The LoRaWAN 1.1 vectors follow section 4.3.1.6 and 4.4 of the
+// specification, their MIC and encryption were computed with the OpenSSL AES
+// and CMAC implementations. Device 260B1234 sends FCnt 5 on data rate 5 and
+// channel 2, acknowledging downlink FCnt 7, with LinkADRAns and
+// LinkCheckReq in FOpts and FRMPayload "hi" on port 1. The downlink is FCnt
+// 7 acknowledging the uplink.
+const (
+	session11FNwkSIntKey = "101112131415161718191A1B1C1D1E1F"
+	session11SNwkSIntKey = "202122232425262728292A2B2C2D2E2F"
+	session11NwkSEncKey  = "303132333435363738393A3B3C3D3E3F"
+	session11AppSKey     = "404142434445464748494A4B4C4D4E4F"
+	session11Uplink      = "4034120B26230500EC6CE701186DCD1D2CA7"
+	session11Downlink    = "6034120B2620070070F34C06"
+)
+
+func session11Keys(t *testing.T) SessionKeys {
+	return SessionKeys{
+		FNwkSIntKey: mustKey(t, session11FNwkSIntKey),
+		SNwkSIntKey: mustKey(t, session11SNwkSIntKey),
+		NwkSEncKey:  mustKey(t, session11NwkSEncKey),
+		AppSKey:     mustKey(t, session11AppSKey),
+	}
+}
+
+func TestValidateDataMIC11(t *testing.T) {
+	txDR, txCh, otherCh := uint8(5), uint8(2), uint8(0)
+
+	tests := []struct {
+		name  string
+		frame string
+		opts  MICOptions
+		valid bool
+	}{
+		{"uplink", session11Uplink, MICOptions{ConfFCnt: 7, TxDR: &txDR, TxCh: &txCh}, true},
+		{"uplink without data rate and channel", session11Uplink, MICOptions{}, true},
+		{"uplink on another channel", session11Uplink, MICOptions{ConfFCnt: 7, TxDR: &txDR, TxCh: &otherCh}, false},
+		{"uplink with wrong conf fcnt", session11Uplink, MICOptions{ConfFCnt: 6, TxDR: &txDR, TxCh: &txCh}, false},
+		{"uplink with wrong fnwk s int key half", "4034120B26230500EC6CE701186DCD1D2CA8", MICOptions{}, false},
+		{"downlink", session11Downlink, MICOptions{ConfFCnt: 5}, true},
+		{"downlink with wrong conf fcnt", session11Downlink, MICOptions{ConfFCnt: 4}, false},
+	}
+
+	for _, test := range tests {
+		var phy PHYPayload
+		if err := phy.UnmarshalBinary(mustDecodeHex(t, test.frame)); err != nil {
+			t.Errorf("%s: decode failed: %v", test.name, err)
+			continue
+		}
+		ok, err := phy.ValidateDataMIC11(session11Keys(t), test.opts)
+		if err != nil {
+			t.Errorf("%s: validate failed: %v", test.name, err)
+			continue
+		}
+		if ok != test.valid {
+			t.Errorf("%s: mic valid %t, expected %t", test.name, ok, test.valid)
+		}
+	}
+}
+
+func TestDecryptFOpts(t *testing.T) {
+	var phy PHYPayload
+	if err := phy.UnmarshalBinary(mustDecodeHex(t, session11Uplink)); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	macPayload := phy.Payload.(*MACPayload)
+
+	macPayload.FOptsEncrypted = true
+	commands, err := macPayload.MACCommands()
+	if err != nil || len(commands) != 0 {
+		t.Errorf("encrypted fopts decoded as %+v: %v", commands, err)
+	}
+	if fields := phy.Fields(); fields["fopts encrypted"] != true {
+		t.Errorf("fields %v, expected fopts encrypted", fields)
+	}
+
+	keys := session11Keys(t)
+	if err := phy.DecryptFOpts(keys.NwkSEncKey); err != nil {
+		t.Fatalf("decrypt fopts failed: %v", err)
+	}
+	if macPayload.FOptsEncrypted {
+		t.Error("fopts still encrypted")
+	}
+	if want := mustDecodeHex(t, "030702"); !bytes.Equal(macPayload.FHDR.FOpts, want) {
+		t.Errorf("fopts %X, expected %X", macPayload.FHDR.FOpts, want)
+	}
+	commands, err = macPayload.MACCommands()
+	if err != nil {
+		t.Fatalf("decode mac commands failed: %v", err)
+	}
+	if len(commands) != 2 || commands[0].Name() != "LinkADRAns" || commands[1].Name() != "LinkCheckReq" {
+		t.Errorf("mac commands %+v, expected LinkADRAns and LinkCheckReq", commands)
+	}
+
+	if err := phy.DecryptFRMPayload(keys.NwkSEncKey, keys.AppSKey); err != nil {
+		t.Fatalf("decrypt failed: %v", err)
+	}
+	if string(macPayload.FRMPayload) != "hi" {
+		t.Errorf("frm payload %q, expected \"hi\"", macPayload.FRMPayload)
+	}
+}
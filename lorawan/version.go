@@ -0,0 +1,98 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lorawan
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MACVersion defines the LoRaWAN version implemented by an end-device.
+type MACVersion byte
+
+// Available LoRaWAN versions
+const (
+	LoRaWAN1_0 MACVersion = iota
+	LoRaWAN1_1
+)
+
+// String implements the stringer interface for MACVersion.
+func (v MACVersion) String() string {
+	if v == LoRaWAN1_1 {
+		return "1.1"
+	}
+	return "1.0"
+}
+
+// MarshalText implements the encoding.TextMarshaler interface for MACVersion.
+func (v MACVersion) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface for MACVersion.
+// All 1.0.x versions are handled as 1.0.
+func (v *MACVersion) UnmarshalText(text []byte) error {
+	s := string(text)
+	switch {
+	case s == "1.0" || strings.HasPrefix(s, "1.0."):
+		*v = LoRaWAN1_0
+	case s == "1.1" || strings.HasPrefix(s, "1.1."):
+		*v = LoRaWAN1_1
+	default:
+		return errors.New("invalid mac version: " + s)
+	}
+	return nil
+}
+
+// SessionKeys contains the session keys of an end-device. LoRaWAN 1.0.x
+// uses a single NwkSKey, which is used for FNwkSIntKey, SNwkSIntKey and
+// NwkSEncKey.
+type SessionKeys struct {
+	FNwkSIntKey AES128Key
+	SNwkSIntKey AES128Key
+	NwkSEncKey  AES128Key
+	AppSKey     AES128Key
+}
+
+// MICOptions contains the LoRaWAN 1.1 MIC inputs that are not part of the
+// frame itself. ConfFCnt is the frame counter of the acknowledged frame when
+// the ACK bit is set. The uplink data rate and channel index are only needed
+// for the SNwkSIntKey half of the uplink MIC, it is not verified when they
+// are unknown (nil).
+type MICOptions struct {
+	ConfFCnt uint16
+	TxDR     *uint8
+	TxCh     *uint8
+}
+
+// deriveJSKey derives the JSIntKey (0x06) or JSEncKey (0x05) from the NwkKey.
+func deriveJSKey(nwkKey AES128Key, prefix byte, devEUI EUI64) AES128Key {
+	b := make([]byte, 16)
+	b[0] = prefix
+	copy(b[1:9], reverse(devEUI[:]))
+
+	var key AES128Key
+	newCipher(nwkKey).Encrypt(key[:], b)
+	return key
+}
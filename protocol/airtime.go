@@ -0,0 +1,131 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"math"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+)
+
+// Default preamble sizes, LoRa in symbols and FSK in bytes.
+const (
+	defaultLoRaPreamble = 8
+	defaultFSKPreamble  = 5
+)
+
+// Airtime returns the time on air of an RF packet with an explicit header
+// (LoRa) or a sync word of 3 bytes and a length byte (FSK). The preamble is
+// given in symbols for LoRa and in bytes for FSK, 0 uses the default.
+func Airtime(dataRate DataRate, codingRate CodingRate, preamble, size uint16, crc bool) (time.Duration, error) {
+	err := dataRate.Validate()
+	if err != nil {
+		return 0, errors.Wrap(err, "airtime failed")
+	}
+
+	switch dataRate.Modulation {
+	case LoRa:
+		if preamble == 0 {
+			preamble = defaultLoRaPreamble
+		}
+		if err := codingRate.Validate(); err != nil {
+			return 0, errors.Wrap(err, "airtime failed")
+		}
+		if codingRate.Denominator == 0 {
+			codingRate.Denominator = 5
+		}
+		return loraAirtime(dataRate, codingRate, preamble, size, crc), nil
+	case FSK:
+		if preamble == 0 {
+			preamble = defaultFSKPreamble
+		}
+		return fskAirtime(dataRate, preamble, size, crc), nil
+	}
+
+	return 0, errors.New("airtime failed: unknown modulation")
+}
+
+// loraAirtime implements the time on air formula of the Semtech LoRa
+// modem designer's guide (AN1200.13).
+func loraAirtime(dataRate DataRate, codingRate CodingRate, preamble, size uint16, crc bool) time.Duration {
+	sf := float64(dataRate.SpreadingFactor)
+	symbol := math.Pow(2, sf) / float64(dataRate.Bandwidth)
+
+	// low data rate optimization is mandated for symbols of 16 ms and more
+	var de float64
+	if symbol >= 0.016 {
+		de = 1
+	}
+	var c float64
+	if crc {
+		c = 1
+	}
+
+	payloadSymbols := 8 + math.Max(math.Ceil((8*float64(size)-4*sf+28+16*c)/(4*(sf-2*de)))*float64(codingRate.Denominator), 0)
+	seconds := (float64(preamble)+4.25)*symbol + payloadSymbols*symbol
+
+	return time.Duration(math.Round(seconds * float64(time.Second)))
+}
+
+// fskAirtime returns the time on air of an FSK packet with a sync word of 3
+// bytes, a length byte and an optional CRC of 2 bytes.
+func fskAirtime(dataRate DataRate, preamble, size uint16, crc bool) time.Duration {
+	bytes := float64(preamble) + 3 + 1 + float64(size)
+	if crc {
+		bytes += 2
+	}
+	seconds := bytes * 8 / float64(dataRate.BitRate)
+
+	return time.Duration(math.Round(seconds * float64(time.Second)))
+}
+
+// Airtime returns the time on air of the received packet.
+func (rxpk *RXPK) Airtime() (time.Duration, error) {
+	if rxpk.DatR == nil {
+		return 0, errors.New("airtime failed: no data rate")
+	}
+	return Airtime(*rxpk.DatR, packetCodingRate(rxpk.CodR), 0, rxpk.Size, rxpk.Stat != 0)
+}
+
+// Airtime returns the time on air of the packet to be emitted.
+func (txpk *TXPK) Airtime() (time.Duration, error) {
+	return Airtime(txpk.DatR, packetCodingRate(txpk.CodR), txpk.Prea, txpk.Size, !txpk.NCRC)
+}
+
+// packetCodingRate returns the coding rate of a packet, a missing codr is off.
+func packetCodingRate(codingRate *CodingRate) CodingRate {
+	if codingRate == nil {
+		return CodingRate{}
+	}
+	return *codingRate
+}
+
+// airtimeFields returns the time on air in milliseconds.
+func airtimeFields(airtime time.Duration, err error) log.Fields {
+	if err != nil {
+		return log.Fields{"airtime error": err.Error()}
+	}
+	return log.Fields{"airtime_ms": float64(airtime) / float64(time.Millisecond)}
+}
@@ -0,0 +1,125 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// acknowledgements maps the packet types that are acknowledged to the type
+// of their acknowledgement.
+var acknowledgements = map[PacketType]PacketType{
+	PushData: PushAck,
+	PullData: PullAck,
+	PullResp: TXAck,
+}
+
+// Exchange is a request and its acknowledgement, matched by the random
+// token of the packets sent between a gateway and the server.
+type Exchange struct {
+	Gateway string // UDP endpoint of the gateway
+	Token   uint16
+	Request PacketType
+	Packet  Packet // request
+	Sent    time.Time
+	Latency time.Duration // time between the request and acknowledgement
+}
+
+type exchangeKey struct {
+	gateway string
+	token   uint16
+	ack     PacketType
+}
+
+// Correlator matches the requests with their acknowledgements per gateway.
+type Correlator struct {
+	sync.Mutex
+	timeout time.Duration
+	pending map[exchangeKey]Exchange
+}
+
+// NewCorrelator returns a correlator that considers an acknowledgement
+// missing when it is not seen within the timeout.
+func NewCorrelator(timeout time.Duration) *Correlator {
+	return &Correlator{
+		timeout: timeout,
+		pending: make(map[exchangeKey]Exchange),
+	}
+}
+
+// Add adds a packet sent at the given time between the gateway (identified
+// by its UDP endpoint) and the server. When the packet acknowledges a
+// pending request, the exchange is returned.
+func (c *Correlator) Add(gateway string, t time.Time, p Packet) (Exchange, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	if ack, ok := acknowledgements[p.Type()]; ok {
+		// TX_ACK was only introduced in protocol version 2
+		if p.Type() == PullResp && p.ProtocolVersion() < ProtoVersion2 {
+			return Exchange{}, false
+		}
+
+		c.pending[exchangeKey{gateway, p.Token(), ack}] = Exchange{
+			Gateway: gateway,
+			Token:   p.Token(),
+			Request: p.Type(),
+			Packet:  p,
+			Sent:    t,
+		}
+		return Exchange{}, false
+	}
+
+	key := exchangeKey{gateway, p.Token(), p.Type()}
+	e, ok := c.pending[key]
+	if !ok {
+		return Exchange{}, false
+	}
+	delete(c.pending, key)
+
+	e.Latency = t.Sub(e.Sent)
+	return e, true
+}
+
+// Expire returns and removes the requests that were not acknowledged within
+// the timeout at the given time, oldest first.
+func (c *Correlator) Expire(t time.Time) []Exchange {
+	c.Lock()
+	defer c.Unlock()
+
+	var expired []Exchange
+	for key, e := range c.pending {
+		if t.Sub(e.Sent) > c.timeout {
+			expired = append(expired, e)
+			delete(c.pending, key)
+		}
+	}
+
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].Sent.Before(expired[j].Sent)
+	})
+
+	return expired
+}
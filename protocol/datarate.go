@@ -0,0 +1,277 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+)
+
+// Modulation defines the modulation of an RF packet.
+type Modulation string
+
+// Available modulations
+const (
+	LoRa Modulation = "LORA"
+	FSK  Modulation = "FSK"
+)
+
+// DataRate implements the data rate which can be either a string (LoRa identifier)
+// or an unsigned integer in case of FSK (bits per second).
+// For LoRa, BitRate is the uncoded bit rate of the spreading factor and
+// bandwidth. A data rate that could not be decoded or is not valid keeps the
+// datr as received in Raw, so it is reported by Validate and encoded again
+// unchanged.
+type DataRate struct {
+	Modulation      Modulation
+	SpreadingFactor uint8  // 5 - 12
+	Bandwidth       uint32 // Hz rather than kHz, so 62.5 kHz is an integer too
+	BitRate         uint32 // bits per second
+	Raw             string // JSON datr of an invalid data rate
+}
+
+var loraDataRateRegexp = regexp.MustCompile(`^SF(\d+)BW(\d+(?:\.\d+)?)$`)
+
+// NewLoRaDataRate returns the LoRa data rate with the given spreading factor
+// and bandwidth (in Hz).
+func NewLoRaDataRate(spreadingFactor uint8, bandwidth uint32) (DataRate, error) {
+	d := DataRate{
+		Modulation:      LoRa,
+		SpreadingFactor: spreadingFactor,
+		Bandwidth:       bandwidth,
+		BitRate:         uint32(uint64(spreadingFactor) * uint64(bandwidth) >> spreadingFactor),
+	}
+	return d, d.Validate()
+}
+
+// NewFSKDataRate returns the FSK data rate with the given bit rate.
+func NewFSKDataRate(bitRate uint32) (DataRate, error) {
+	d := DataRate{
+		Modulation: FSK,
+		BitRate:    bitRate,
+	}
+	return d, d.Validate()
+}
+
+// Validate checks that the data rate can be used by a concentrator.
+func (d DataRate) Validate() error {
+	switch d.Modulation {
+	case LoRa:
+		if d.SpreadingFactor < 5 || d.SpreadingFactor > 12 {
+			return errors.New(fmt.Sprintf("invalid data rate: spreading factor %d", d.SpreadingFactor))
+		}
+		if d.Bandwidth != 125000 && d.Bandwidth != 250000 && d.Bandwidth != 500000 {
+			return errors.New(fmt.Sprintf("invalid data rate: bandwidth %s kHz", d.kHz()))
+		}
+	case FSK:
+		if d.BitRate == 0 {
+			return errors.New("invalid data rate: bit rate 0")
+		}
+	case "":
+		return errors.New(fmt.Sprintf("invalid data rate: %s", d.Raw))
+	default:
+		return errors.New(fmt.Sprintf("invalid data rate: modulation %q", d.Modulation))
+	}
+
+	return nil
+}
+
+// kHz returns the bandwidth in kHz.
+func (d DataRate) kHz() string {
+	return strconv.FormatFloat(float64(d.Bandwidth)/1000, 'f', -1, 64)
+}
+
+// String implements the stringer interface for DataRate.
+func (d DataRate) String() string {
+	if len(d.Raw) > 0 {
+		if s, err := strconv.Unquote(d.Raw); err == nil {
+			return s
+		}
+		return d.Raw
+	}
+
+	if d.Modulation == LoRa {
+		return fmt.Sprintf("SF%dBW%s", d.SpreadingFactor, d.kHz())
+	}
+
+	return strconv.FormatUint(uint64(d.BitRate), 10)
+}
+
+// MarshalJSON implements the json.Marshaler interface for DataRate.
+func (d DataRate) MarshalJSON() ([]byte, error) {
+	if len(d.Raw) > 0 {
+		return []byte(d.Raw), nil
+	}
+	if d.Modulation == LoRa {
+		return []byte(`"` + d.String() + `"`), nil
+	}
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for DataRate. A
+// datr that is not a valid data rate does not fail the decoding, it is kept
+// in Raw and reported by Validate.
+func (d *DataRate) UnmarshalJSON(data []byte) error {
+	dataRate, err := parseDataRate(data)
+	if err != nil {
+		dataRate.Raw = string(data)
+	}
+	*d = dataRate
+	return nil
+}
+
+// parseDataRate parses the JSON datr, the data rate is returned with the
+// error when it was parsed but is not valid.
+func parseDataRate(data []byte) (DataRate, error) {
+	if i, err := strconv.ParseUint(string(data), 10, 32); err == nil {
+		return NewFSKDataRate(uint32(i))
+	}
+
+	s, err := strconv.Unquote(string(data))
+	if err != nil {
+		return DataRate{}, errors.Wrap(err, "invalid data rate")
+	}
+
+	m := loraDataRateRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return DataRate{}, errors.New(fmt.Sprintf("invalid data rate: %q", s))
+	}
+
+	sf, err := strconv.ParseUint(m[1], 10, 8)
+	if err != nil {
+		return DataRate{}, errors.Wrap(err, "invalid data rate")
+	}
+	bw, _ := strconv.ParseFloat(m[2], 64)
+	if bw*1000 > math.MaxUint32 {
+		return DataRate{}, errors.New(fmt.Sprintf("invalid data rate: %q", s))
+	}
+	return NewLoRaDataRate(uint8(sf), uint32(math.Round(bw*1000)))
+}
+
+// dataRateFields reports a data rate that is not valid.
+func dataRateFields(dataRate *DataRate) log.Fields {
+	if dataRate == nil {
+		return nil
+	}
+	if err := dataRate.Validate(); err != nil {
+		return log.Fields{"data rate error": err.Error()}
+	}
+	return nil
+}
+
+// CodingRate defines the LoRa ECC coding rate 4/x, where x is the
+// denominator (5 - 8). The zero value means no coding rate ("OFF", eg. FSK).
+// A codr that is not recognised, eg. "2/3" of LR-FHSS or "4/5LI", keeps the
+// codr as received in Raw, so it is reported by Validate and encoded again
+// unchanged.
+type CodingRate struct {
+	Denominator uint8  // 5 - 8, 0 when off
+	Raw         string // JSON codr of an unrecognised coding rate
+}
+
+var codingRateRegexp = regexp.MustCompile(`^4/([5-8])$`)
+
+// NewCodingRate returns the LoRa coding rate 4/denominator.
+func NewCodingRate(denominator uint8) (CodingRate, error) {
+	c := CodingRate{Denominator: denominator}
+	return c, c.Validate()
+}
+
+// Validate checks that the coding rate is off or one of 4/5 - 4/8.
+func (c CodingRate) Validate() error {
+	if len(c.Raw) > 0 {
+		return errors.New(fmt.Sprintf("unrecognised coding rate: %s", c.Raw))
+	}
+	if c.Denominator != 0 && (c.Denominator < 5 || c.Denominator > 8) {
+		return errors.New(fmt.Sprintf("unrecognised coding rate: 4/%d", c.Denominator))
+	}
+	return nil
+}
+
+// String implements the stringer interface for CodingRate.
+func (c CodingRate) String() string {
+	if len(c.Raw) > 0 {
+		if s, err := strconv.Unquote(c.Raw); err == nil {
+			return s
+		}
+		return c.Raw
+	}
+	if c.Denominator == 0 {
+		return "OFF"
+	}
+	return fmt.Sprintf("4/%d", c.Denominator)
+}
+
+// MarshalJSON implements the json.Marshaler interface for CodingRate.
+func (c CodingRate) MarshalJSON() ([]byte, error) {
+	if len(c.Raw) > 0 {
+		return []byte(c.Raw), nil
+	}
+	return []byte(`"` + c.String() + `"`), nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for CodingRate. A
+// codr that is not recognised does not fail the decoding, it is kept in Raw
+// and reported by Validate.
+func (c *CodingRate) UnmarshalJSON(data []byte) error {
+	codingRate, err := parseCodingRate(data)
+	if err != nil {
+		codingRate = CodingRate{Raw: string(data)}
+	}
+	*c = codingRate
+	return nil
+}
+
+// parseCodingRate parses the JSON codr.
+func parseCodingRate(data []byte) (CodingRate, error) {
+	s, err := strconv.Unquote(string(data))
+	if err != nil {
+		return CodingRate{}, errors.Wrap(err, "unrecognised coding rate")
+	}
+	if s == "OFF" {
+		return CodingRate{}, nil
+	}
+
+	m := codingRateRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return CodingRate{}, errors.New(fmt.Sprintf("unrecognised coding rate: %q", s))
+	}
+	d, _ := strconv.ParseUint(m[1], 10, 8)
+	return NewCodingRate(uint8(d))
+}
+
+// codingRateFields reports a coding rate that is not recognised.
+func codingRateFields(codingRate *CodingRate) log.Fields {
+	if codingRate == nil {
+		return nil
+	}
+	if err := codingRate.Validate(); err != nil {
+		return log.Fields{"coding rate error": err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDataRateUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		datr      string
+		bandwidth uint32
+		valid     bool
+		text      string
+	}{
+		{`"SF7BW125"`, 125000, true, "SF7BW125"},
+		{`"SF12BW500"`, 500000, true, "SF12BW500"},
+		{`"SF7BW62.5"`, 62500, false, "SF7BW62.5"},
+		{`"SF12BW812"`, 812000, false, "SF12BW812"},
+		{`"SF13BW125"`, 125000, false, "SF13BW125"},
+		{`"LR-FHSS"`, 0, false, "LR-FHSS"},
+		{`50000`, 0, true, "50000"},
+		{`0`, 0, false, "0"},
+	}
+
+	for _, test := range tests {
+		var d DataRate
+		if err := json.Unmarshal([]byte(test.datr), &d); err != nil {
+			t.Errorf("%s: decode failed: %v", test.datr, err)
+			continue
+		}
+		if d.Bandwidth != test.bandwidth {
+			t.Errorf("%s: bandwidth %d Hz, expected %d Hz", test.datr, d.Bandwidth, test.bandwidth)
+		}
+		if err := d.Validate(); (err == nil) != test.valid {
+			t.Errorf("%s: validate returned %v", test.datr, err)
+		}
+		if d.String() != test.text {
+			t.Errorf("%s: string %q, expected %q", test.datr, d.String(), test.text)
+		}
+
+		data, err := json.Marshal(d)
+		if err != nil {
+			t.Errorf("%s: encode failed: %v", test.datr, err)
+		} else if string(data) != test.datr {
+			t.Errorf("%s: encoded as %s", test.datr, data)
+		}
+	}
+}
+
+func TestCodingRateUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		codr        string
+		denominator uint8
+		valid       bool
+		text        string
+	}{
+		{`"4/5"`, 5, true, "4/5"},
+		{`"4/8"`, 8, true, "4/8"},
+		{`"OFF"`, 0, true, "OFF"},
+		{`"2/3"`, 0, false, "2/3"},
+		{`"4/5LI"`, 0, false, "4/5LI"},
+		{`"4/9"`, 0, false, "4/9"},
+		{`5`, 0, false, "5"},
+	}
+
+	for _, test := range tests {
+		var c CodingRate
+		if err := json.Unmarshal([]byte(test.codr), &c); err != nil {
+			t.Errorf("%s: decode failed: %v", test.codr, err)
+			continue
+		}
+		if c.Denominator != test.denominator {
+			t.Errorf("%s: denominator %d, expected %d", test.codr, c.Denominator, test.denominator)
+		}
+		if err := c.Validate(); (err == nil) != test.valid {
+			t.Errorf("%s: validate returned %v", test.codr, err)
+		}
+		if c.String() != test.text {
+			t.Errorf("%s: string %q, expected %q", test.codr, c.String(), test.text)
+		}
+
+		data, err := json.Marshal(c)
+		if err != nil {
+			t.Errorf("%s: encode failed: %v", test.codr, err)
+		} else if string(data) != test.codr {
+			t.Errorf("%s: encoded as %s", test.codr, data)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// keepaliveTolerance is the fraction a PULL_DATA interval may deviate from
+// the average keepalive interval before it is considered irregular.
+const keepaliveTolerance = 0.5
+
+// keepaliveSamples is the number of PULL_DATA intervals needed before the
+// keepalive is checked.
+const keepaliveSamples = 3
+
+// Gateway is the state of a gateway, built from the packets it sent.
+type Gateway struct {
+	EUI                [8]byte
+	FirstSeen          time.Time
+	LastSeen           time.Time
+	UpstreamEndpoint   string        // UDP source of PUSH_DATA
+	DownstreamEndpoint string        // UDP source of PULL_DATA and TX_ACK
+	LastPullData       time.Time     // time of the last keepalive
+	KeepaliveInterval  time.Duration // average PULL_DATA interval
+	Stat               *Stat         // last status report
+	Silent             bool
+
+	keepalives int
+}
+
+// Fields returns the state of the gateway as log fields.
+func (g *Gateway) Fields() log.Fields {
+	fields := log.Fields{
+		"gateway mac":         fmt.Sprintf("%X", g.EUI),
+		"first seen":          g.FirstSeen,
+		"last seen":           g.LastSeen,
+		"upstream endpoint":   g.UpstreamEndpoint,
+		"downstream endpoint": g.DownstreamEndpoint,
+		"keepalive interval":  g.KeepaliveInterval,
+	}
+	if g.Stat != nil {
+		fields["last stat"] = time.Time(g.Stat.Time)
+	}
+	return fields
+}
+
+// GatewayEventType defines the gateway event type.
+type GatewayEventType byte
+
+// Available gateway events
+const (
+	GatewayNew GatewayEventType = iota
+	GatewaySilent
+	GatewayResumed
+	KeepaliveIrregular
+	EndpointChanged
+)
+
+// String implements the stringer interface for GatewayEventType.
+func (t GatewayEventType) String() string {
+	switch t {
+	case GatewayNew:
+		return "new gateway"
+	case GatewaySilent:
+		return "gateway silent"
+	case GatewayResumed:
+		return "gateway resumed"
+	case KeepaliveIrregular:
+		return "irregular keepalive"
+	case EndpointChanged:
+		return "endpoint changed"
+	default:
+		return fmt.Sprintf("GatewayEventType(%d)", t)
+	}
+}
+
+// GatewayEvent is a change in the state of a gateway.
+type GatewayEvent struct {
+	Type     GatewayEventType
+	Gateway  Gateway
+	Endpoint string        // previous endpoint (EndpointChanged)
+	Socket   string        // "upstream" or "downstream" (EndpointChanged)
+	Interval time.Duration // observed interval (KeepaliveIrregular)
+}
+
+// Fields returns the event as log fields.
+func (e GatewayEvent) Fields() log.Fields {
+	fields := e.Gateway.Fields()
+	switch e.Type {
+	case EndpointChanged:
+		fields["previous endpoint"] = e.Endpoint
+		fields["socket"] = e.Socket
+	case KeepaliveIrregular:
+		fields["interval"] = e.Interval
+	}
+	return fields
+}
+
+// GatewayTable keeps the state of every gateway seen and the UDP endpoint
+// each gateway last sent a PULL_DATA from, so downlinks sent to the endpoint
+// can be attributed to the gateway. The endpoint is forgotten when the
+// gateway goes silent.
+type GatewayTable struct {
+	sync.Mutex
+	timeout   time.Duration
+	gateways  map[[8]byte]*Gateway
+	endpoints map[string][8]byte
+}
+
+// NewGatewayTable returns a gateway table that considers a gateway silent
+// when no packets are seen within the timeout.
+func NewGatewayTable(timeout time.Duration) *GatewayTable {
+	return &GatewayTable{
+		timeout:   timeout,
+		gateways:  make(map[[8]byte]*Gateway),
+		endpoints: make(map[string][8]byte),
+	}
+}
+
+// Gateway returns the state of the gateway.
+func (gt *GatewayTable) Gateway(eui [8]byte) (Gateway, bool) {
+	gt.Lock()
+	defer gt.Unlock()
+
+	g, ok := gt.gateways[eui]
+	if !ok {
+		return Gateway{}, false
+	}
+	return *g, true
+}
+
+// GatewayAt returns the gateway that last sent a PULL_DATA from the UDP
+// endpoint.
+func (gt *GatewayTable) GatewayAt(endpoint string) ([8]byte, bool) {
+	gt.Lock()
+	defer gt.Unlock()
+
+	eui, ok := gt.endpoints[endpoint]
+	return eui, ok
+}
+
+// Update updates the state of the gateway that sent the packet from the
+// given UDP endpoint at the given time. Packets without gateway are
+// ignored.
+func (gt *GatewayTable) Update(endpoint string, t time.Time, p Packet) []GatewayEvent {
+	eui, ok := p.GatewayEUI()
+	if !ok || p.Direction() != Uplink {
+		return nil
+	}
+
+	gt.Lock()
+	defer gt.Unlock()
+
+	var events []GatewayEvent
+
+	g, ok := gt.gateways[eui]
+	if !ok {
+		g = &Gateway{
+			EUI:       eui,
+			FirstSeen: t,
+		}
+		gt.gateways[eui] = g
+		events = append(events, GatewayEvent{Type: GatewayNew})
+	}
+
+	if g.Silent {
+		g.Silent = false
+		events = append(events, GatewayEvent{Type: GatewayResumed})
+	}
+
+	// the packet forwarder sends PUSH_DATA from its upstream socket and
+	// PULL_DATA and TX_ACK from its downstream socket, each with its own
+	// port, so each endpoint is only compared with packets of its socket
+	socket, previous := "downstream", &g.DownstreamEndpoint
+	if p.Type() == PushData {
+		socket, previous = "upstream", &g.UpstreamEndpoint
+	}
+	if len(*previous) > 0 && *previous != endpoint {
+		events = append(events, GatewayEvent{Type: EndpointChanged, Endpoint: *previous, Socket: socket})
+		gt.removeEndpoint(*previous, eui)
+	}
+	*previous = endpoint
+
+	switch p := p.(type) {
+	case *PullDataPacket:
+		gt.endpoints[endpoint] = eui
+		if event, ok := g.keepalive(t, gt.timeout); ok {
+			events = append(events, event)
+		}
+	case *PushDataPacket:
+		if p.Payload.Stat != nil {
+			g.Stat = p.Payload.Stat
+		}
+	}
+
+	g.LastSeen = t
+
+	for i := range events {
+		events[i].Gateway = *g
+	}
+
+	return events
+}
+
+// keepalive updates the average keepalive interval with a PULL_DATA at the
+// given time and checks whether the interval is regular.
+func (g *Gateway) keepalive(t time.Time, timeout time.Duration) (GatewayEvent, bool) {
+	last := g.LastPullData
+	g.LastPullData = t
+	if last.IsZero() {
+		return GatewayEvent{}, false
+	}
+
+	interval := t.Sub(last)
+	if interval > timeout {
+		// the gateway was silent, start over
+		g.keepalives = 0
+		g.KeepaliveInterval = 0
+		return GatewayEvent{}, false
+	}
+
+	var event GatewayEvent
+	irregular := false
+	if g.keepalives >= keepaliveSamples {
+		deviation := interval - g.KeepaliveInterval
+		if deviation < 0 {
+			deviation = -deviation
+		}
+		if float64(deviation) > float64(g.KeepaliveInterval)*keepaliveTolerance {
+			irregular = true
+			event = GatewayEvent{Type: KeepaliveIrregular, Interval: interval}
+		}
+	}
+
+	g.keepalives++
+	if g.keepalives == 1 {
+		g.KeepaliveInterval = interval
+	} else {
+		g.KeepaliveInterval += (interval - g.KeepaliveInterval) / 8
+	}
+
+	return event, irregular
+}
+
+// Expire marks the gateways that were not seen within the timeout at the
+// given time as silent and returns an event for every gateway that went
+// silent.
+func (gt *GatewayTable) Expire(t time.Time) []GatewayEvent {
+	gt.Lock()
+	defer gt.Unlock()
+
+	var events []GatewayEvent
+	for _, g := range gt.gateways {
+		if !g.Silent && t.Sub(g.LastSeen) > gt.timeout {
+			g.Silent = true
+			gt.removeEndpoint(g.DownstreamEndpoint, g.EUI)
+			events = append(events, GatewayEvent{Type: GatewaySilent, Gateway: *g})
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Gateway.LastSeen.Before(events[j].Gateway.LastSeen)
+	})
+
+	return events
+}
+
+// removeEndpoint forgets the UDP endpoint of the gateway, unless another
+// gateway sent a PULL_DATA from it since.
+func (gt *GatewayTable) removeEndpoint(endpoint string, eui [8]byte) {
+	if current, ok := gt.endpoints[endpoint]; ok && current == eui {
+		delete(gt.endpoints, endpoint)
+	}
+}
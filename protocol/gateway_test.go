@@ -0,0 +1,119 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGatewayTableSocketEndpoints(t *testing.T) {
+	const (
+		upstream   = "192.0.2.1:50123"
+		downstream = "192.0.2.1:50124"
+	)
+	eui := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	pushData := &PushDataPacket{Protocol: ProtoVersion2, GatewayMac: eui}
+	pullData := &PullDataPacket{Protocol: ProtoVersion2, GatewayMac: eui}
+	txAck := &TXAckPacket{Protocol: ProtoVersion2, GatewayMac: eui}
+
+	table := NewGatewayTable(time.Minute)
+	start := time.Unix(0, 0)
+
+	packets := []struct {
+		endpoint string
+		packet   Packet
+	}{
+		{upstream, pushData},
+		{downstream, pullData},
+		{upstream, pushData},
+		{downstream, txAck},
+		{downstream, pullData},
+		{upstream, pushData},
+	}
+	for i, p := range packets {
+		events := table.Update(p.endpoint, start.Add(time.Duration(i)*time.Second), p.packet)
+		for _, event := range events {
+			if event.Type != GatewayNew {
+				t.Errorf("packet %d: unexpected %s event", i, event.Type)
+			}
+		}
+	}
+
+	g, ok := table.Gateway(eui)
+	if !ok {
+		t.Fatal("gateway not found")
+	}
+	if g.UpstreamEndpoint != upstream {
+		t.Errorf("upstream endpoint %q, expected %q", g.UpstreamEndpoint, upstream)
+	}
+	if g.DownstreamEndpoint != downstream {
+		t.Errorf("downstream endpoint %q, expected %q", g.DownstreamEndpoint, downstream)
+	}
+
+	// a NAT rebinding of the upstream socket
+	const rebound = "192.0.2.1:60000"
+	events := table.Update(rebound, start.Add(time.Minute), pushData)
+	if len(events) != 1 || events[0].Type != EndpointChanged {
+		t.Fatalf("expected an endpoint changed event, got %v", events)
+	}
+	if events[0].Socket != "upstream" || events[0].Endpoint != upstream {
+		t.Errorf("unexpected event %+v", events[0])
+	}
+}
+
+func TestGatewayTableEndpointExpiry(t *testing.T) {
+	const (
+		first  = "192.0.2.1:50124"
+		second = "192.0.2.1:60000"
+	)
+	a := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	b := [8]byte{8, 7, 6, 5, 4, 3, 2, 1}
+
+	table := NewGatewayTable(time.Minute)
+	start := time.Unix(0, 0)
+
+	// gateway a moves to the second endpoint, gateway b takes over the first
+	table.Update(first, start, &PullDataPacket{Protocol: ProtoVersion2, GatewayMac: a})
+	table.Update(second, start.Add(time.Second), &PullDataPacket{Protocol: ProtoVersion2, GatewayMac: a})
+	if eui, ok := table.GatewayAt(first); ok {
+		t.Errorf("previous endpoint still attributed to %X", eui)
+	}
+	table.Update(first, start.Add(time.Minute), &PullDataPacket{Protocol: ProtoVersion2, GatewayMac: b})
+
+	events := table.Expire(start.Add(90 * time.Second))
+	if len(events) != 1 || events[0].Type != GatewaySilent || events[0].Gateway.EUI != a {
+		t.Fatalf("expected gateway %X to go silent, got %v", a, events)
+	}
+	if eui, ok := table.GatewayAt(second); ok {
+		t.Errorf("endpoint of silent gateway still attributed to %X", eui)
+	}
+	if eui, ok := table.GatewayAt(first); !ok || eui != b {
+		t.Errorf("endpoint attributed to %X (%t), expected %X", eui, ok, b)
+	}
+
+	table.Expire(start.Add(3 * time.Minute))
+	if len(table.endpoints) != 0 {
+		t.Errorf("%d endpoints after all gateways went silent, expected none", len(table.endpoints))
+	}
+}
@@ -0,0 +1,154 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+)
+
+// unmarshalJSONExtra decodes data into the struct pointed to by v and
+// returns the keys that are not known by the struct.
+func unmarshalJSONExtra(data []byte, v interface{}) (map[string]json.RawMessage, error) {
+	err := json.Unmarshal(data, v)
+	if err != nil {
+		return nil, err
+	}
+
+	var all map[string]json.RawMessage
+	err = json.Unmarshal(data, &all)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range jsonKeys(reflect.TypeOf(v).Elem()) {
+		delete(all, key)
+	}
+
+	if len(all) == 0 {
+		return nil, nil
+	}
+
+	return all, nil
+}
+
+// marshalJSONExtra encodes the struct v and appends the extra keys that are
+// not known by the struct.
+func marshalJSONExtra(v interface{}, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	known := make(map[string]bool)
+	for _, key := range jsonKeys(reflect.TypeOf(v)) {
+		known[key] = true
+	}
+
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		if !known[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var buffer bytes.Buffer
+	buffer.Write(data[:len(data)-1])
+	for _, key := range keys {
+		if buffer.Len() > 1 {
+			buffer.WriteByte(',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(name)
+		buffer.WriteByte(':')
+		buffer.Write(extra[key])
+	}
+	buffer.WriteByte('}')
+
+	return buffer.Bytes(), nil
+}
+
+// jsonKeys returns the json keys of the fields of struct type t.
+func jsonKeys(t reflect.Type) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("json")
+		name := strings.Split(tag, ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		keys = append(keys, name)
+	}
+	return keys
+}
+
+// extraFields returns the unknown keys as log fields, so vendor extensions
+// show up in the logs.
+func extraFields(extra map[string]json.RawMessage) log.Fields {
+	if len(extra) == 0 {
+		return log.Fields{}
+	}
+
+	values := make(map[string]interface{}, len(extra))
+	for key, raw := range extra {
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			value = string(raw)
+		}
+		values[key] = value
+	}
+
+	return log.Fields{
+		"extra": values,
+	}
+}
+
+// rsigFields returns the signal information per antenna as log fields.
+func rsigFields(rsig []RSig) log.Fields {
+	if len(rsig) == 0 {
+		return log.Fields{}
+	}
+
+	return log.Fields{
+		"rsig": rsig,
+	}
+}
+
+// addFields adds the log fields of src to dst.
+func addFields(dst, src log.Fields) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
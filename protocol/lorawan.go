@@ -0,0 +1,376 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/apex/log"
+	"github.com/bullettime/lora-logger/keystore"
+	"github.com/bullettime/lora-logger/lorawan"
+	"github.com/bullettime/lora-logger/region"
+	"github.com/pkg/errors"
+)
+
+// DecodeData decodes the base64 encoded RF packet payload of a rxpk or txpk,
+// padding is optional.
+func DecodeData(data string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "="))
+}
+
+// decodePHYPayload decodes the LoRaWAN frame in the base64 encoded RF
+// packet payload.
+func decodePHYPayload(data string) (*lorawan.PHYPayload, error) {
+	b, err := DecodeData(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode phy payload failed")
+	}
+
+	var phyPayload lorawan.PHYPayload
+	err = phyPayload.UnmarshalBinary(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode phy payload failed")
+	}
+
+	return &phyPayload, nil
+}
+
+// phyPayloadFields returns the decoded LoRaWAN frame as log fields. If the
+// frame could not be decoded, the error is returned as a field instead.
+func phyPayloadFields(data string) log.Fields {
+	phyPayload, err := decodePHYPayload(data)
+	if err != nil {
+		return log.Fields{
+			"lorawan error": err.Error(),
+		}
+	}
+
+	return phyPayload.Fields()
+}
+
+// frameFields returns the LoRaWAN frame of an RF packet as log fields, the
+// frame decrypted by a Decrypter or else the frame decoded without keys.
+func frameFields(frame log.Fields, data string) log.Fields {
+	if frame != nil {
+		return frame
+	}
+	return phyPayloadFields(data)
+}
+
+// Decrypter verifies the MIC and decrypts the LoRaWAN frames of the devices
+// in a key store. It keeps the frame counters and join-requests seen so far,
+// LoRaWAN 1.1 needs them to verify later frames.
+type Decrypter struct {
+	sync.Mutex
+	keys         *keystore.Store
+	plan         *region.Plan
+	fCntUp       map[lorawan.DevAddr]uint16
+	fCntDown     map[lorawan.DevAddr]uint16
+	joinRequests map[lorawan.EUI64]lorawan.JoinRequestPayload
+}
+
+// NewDecrypter returns a decrypter using the device keys of the store. The
+// channel plan gives the uplink data rate and channel index of LoRaWAN 1.1
+// MICs, it is nil when no region is configured.
+func NewDecrypter(keys *keystore.Store, plan *region.Plan) *Decrypter {
+	return &Decrypter{
+		keys:         keys,
+		plan:         plan,
+		fCntUp:       make(map[lorawan.DevAddr]uint16),
+		fCntDown:     make(map[lorawan.DevAddr]uint16),
+		joinRequests: make(map[lorawan.EUI64]lorawan.JoinRequestPayload),
+	}
+}
+
+// Decrypt decrypts the LoRaWAN frames of the RF packets of a PUSH_DATA or
+// PULL_RESP, they are logged with the packet. Other packets are ignored.
+func (d *Decrypter) Decrypt(p Packet) {
+	switch p := p.(type) {
+	case *PushDataPacket:
+		for i := range p.Payload.RXPK {
+			d.DecryptRXPK(&p.Payload.RXPK[i])
+		}
+	case *PullRespPacket:
+		p.Payload.TXPK.Frame = d.frameFields(p.Payload.TXPK.Data, lorawan.MICOptions{})
+	}
+}
+
+// DecryptRXPK decrypts the LoRaWAN frame of the received packet, it is
+// logged with the packet. The data rate and channel index of the packet in
+// the channel plan of the decrypter are used to verify LoRaWAN 1.1 uplinks.
+func (d *Decrypter) DecryptRXPK(rxpk *RXPK) {
+	var opts lorawan.MICOptions
+	if lookup, ok := regionLookup(d.plan, true, rxpk.Freq, rxpk.DatR); ok {
+		if lookup.DataRate >= 0 {
+			txDR := uint8(lookup.DataRate)
+			opts.TxDR = &txDR
+		}
+		if lookup.Channel >= 0 && !lookup.RX2 {
+			txCh := uint8(lookup.Channel)
+			opts.TxCh = &txCh
+		}
+	}
+	rxpk.Frame = d.frameFields(rxpk.Data, opts)
+}
+
+// frameFields returns the decrypted LoRaWAN frame in the base64 encoded RF
+// packet payload as log fields, with the outcome of the verification. The
+// MIC options carry the uplink data rate and channel index when known.
+func (d *Decrypter) frameFields(data string, opts lorawan.MICOptions) log.Fields {
+	phyPayload, err := decodePHYPayload(data)
+	if err != nil {
+		return log.Fields{
+			"lorawan error": err.Error(),
+		}
+	}
+
+	keyFields := d.decryptPHYPayload(phyPayload, opts)
+	fields := phyPayload.Fields()
+	for k, v := range keyFields {
+		fields[k] = v
+	}
+
+	return fields
+}
+
+// micOptions adds the ConfFCnt to the LoRaWAN 1.1 MIC options of a data
+// message. The frame counter of the acknowledged frame is not part of the
+// frame, when the ACK bit is set it is approximated by the last frame
+// counter seen in the other direction.
+func (d *Decrypter) micOptions(payload *lorawan.MACPayload, opts lorawan.MICOptions) lorawan.MICOptions {
+	if !payload.FHDR.FCtrl.ACK {
+		return opts
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if payload.Uplink() {
+		opts.ConfFCnt = d.fCntDown[payload.FHDR.DevAddr]
+	} else {
+		opts.ConfFCnt = d.fCntUp[payload.FHDR.DevAddr]
+	}
+
+	return opts
+}
+
+// recordFCnt stores the frame counter of a data message.
+func (d *Decrypter) recordFCnt(payload *lorawan.MACPayload) {
+	d.Lock()
+	defer d.Unlock()
+
+	if payload.Uplink() {
+		d.fCntUp[payload.FHDR.DevAddr] = payload.FHDR.FCnt
+	} else {
+		d.fCntDown[payload.FHDR.DevAddr] = payload.FHDR.FCnt
+	}
+}
+
+// recordJoinRequest stores the last join-request of a device.
+func (d *Decrypter) recordJoinRequest(payload *lorawan.JoinRequestPayload) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.joinRequests[payload.DevEUI] = *payload
+}
+
+// lastJoinRequest returns the last join-request of a device.
+func (d *Decrypter) lastJoinRequest(devEUI lorawan.EUI64) (lorawan.JoinRequestPayload, bool) {
+	d.Lock()
+	defer d.Unlock()
+
+	joinRequest, ok := d.joinRequests[devEUI]
+	return joinRequest, ok
+}
+
+// decryptPHYPayload uses the configured device keys to verify the MIC and
+// decrypt the frame. It returns the outcome as log fields.
+func (d *Decrypter) decryptPHYPayload(phyPayload *lorawan.PHYPayload, opts lorawan.MICOptions) log.Fields {
+	switch payload := phyPayload.Payload.(type) {
+	case *lorawan.MACPayload:
+		defer d.recordFCnt(payload)
+		return d.decryptMACPayload(phyPayload, payload, d.micOptions(payload, opts))
+	case *lorawan.JoinRequestPayload:
+		d.recordJoinRequest(payload)
+		return d.validateJoinRequest(phyPayload, payload)
+	case *lorawan.JoinAcceptPayload:
+		return d.decryptJoinAccept(phyPayload)
+	case *lorawan.RejoinRequestPayload:
+		return d.validateRejoinRequest(phyPayload, payload)
+	}
+
+	return log.Fields{}
+}
+
+func (d *Decrypter) decryptMACPayload(phyPayload *lorawan.PHYPayload, payload *lorawan.MACPayload, opts lorawan.MICOptions) log.Fields {
+	fields := log.Fields{}
+
+	devices := d.keys.Sessions(payload.FHDR.DevAddr)
+	if len(devices) == 0 {
+		return fields
+	}
+
+	// LoRaWAN 1.1 FOpts are encrypted, they are not decoded as MAC commands
+	// unless a 1.1 session verifies the frame
+	for _, device := range devices {
+		if device.MACVersion == lorawan.LoRaWAN1_1 && len(payload.FHDR.FOpts) > 0 {
+			payload.FOptsEncrypted = true
+		}
+	}
+
+	fields["mic_valid"] = false
+	for _, device := range devices {
+		var (
+			keys = device.SessionKeys()
+			ok   bool
+			err  error
+		)
+
+		if device.MACVersion == lorawan.LoRaWAN1_1 {
+			ok, err = phyPayload.ValidateDataMIC11(keys, opts)
+		} else {
+			ok, err = phyPayload.ValidateDataMIC(keys.FNwkSIntKey)
+		}
+		if err != nil {
+			fields["lorawan error"] = err.Error()
+			return fields
+		}
+		if !ok {
+			continue
+		}
+
+		fields["mic_valid"] = true
+		fields["dev eui"] = device.DevEUI
+		fields["mac version"] = device.MACVersion.String()
+
+		if device.MACVersion == lorawan.LoRaWAN1_1 {
+			addFields(fields, mic11Fields(payload, opts))
+			err = phyPayload.DecryptFOpts(keys.NwkSEncKey)
+			if err != nil {
+				fields["lorawan error"] = err.Error()
+				return fields
+			}
+		} else {
+			payload.FOptsEncrypted = false
+		}
+
+		err = phyPayload.DecryptFRMPayload(keys.NwkSEncKey, keys.AppSKey)
+		if err != nil {
+			fields["lorawan error"] = err.Error()
+		}
+		return fields
+	}
+
+	return fields
+}
+
+// mic11Fields reports the parts of a LoRaWAN 1.1 data MIC that could not be
+// verified exactly.
+func mic11Fields(payload *lorawan.MACPayload, opts lorawan.MICOptions) log.Fields {
+	fields := log.Fields{}
+	if payload.Uplink() && (opts.TxDR == nil || opts.TxCh == nil) {
+		// without data rate and channel index only the FNwkSIntKey half
+		fields["mic_check"] = "partial"
+	}
+	if payload.FHDR.FCtrl.ACK {
+		fields["mic conf fcnt"] = fmt.Sprintf("%d (last seen)", opts.ConfFCnt)
+	}
+	return fields
+}
+
+func (d *Decrypter) validateJoinRequest(phyPayload *lorawan.PHYPayload, payload *lorawan.JoinRequestPayload) log.Fields {
+	fields := log.Fields{}
+
+	device, ok := d.keys.Device(payload.DevEUI)
+	if !ok {
+		return fields
+	}
+
+	ok, err := phyPayload.ValidateJoinRequestMIC(device.JoinKey())
+	if err != nil {
+		fields["lorawan error"] = err.Error()
+		return fields
+	}
+	fields["mic_valid"] = ok
+	fields["mac version"] = device.MACVersion.String()
+
+	return fields
+}
+
+func (d *Decrypter) decryptJoinAccept(phyPayload *lorawan.PHYPayload) log.Fields {
+	fields := log.Fields{}
+
+	// the join-accept does not identify the device, so try every device
+	// with a join key until the MIC matches
+	for _, device := range d.keys.Devices() {
+		var (
+			ok  bool
+			err error
+		)
+
+		if device.JoinKey() == (lorawan.AES128Key{}) {
+			continue
+		}
+		fields["mic_valid"] = false
+
+		joinRequest, seen := d.lastJoinRequest(device.DevEUI)
+		if device.MACVersion == lorawan.LoRaWAN1_1 && seen {
+			ok, err = phyPayload.DecryptJoinAccept11(device.NwkKey, device.DevEUI, joinRequest.JoinEUI, joinRequest.DevNonce)
+		} else {
+			ok, err = phyPayload.DecryptJoinAccept(device.JoinKey())
+		}
+		if err != nil {
+			fields["lorawan error"] = err.Error()
+			return fields
+		}
+		if ok {
+			fields["mic_valid"] = true
+			fields["dev eui"] = device.DevEUI
+			fields["mac version"] = device.MACVersion.String()
+			return fields
+		}
+	}
+
+	return fields
+}
+
+func (d *Decrypter) validateRejoinRequest(phyPayload *lorawan.PHYPayload, payload *lorawan.RejoinRequestPayload) log.Fields {
+	fields := log.Fields{}
+
+	device, ok := d.keys.Device(payload.DevEUI)
+	if !ok {
+		return fields
+	}
+
+	ok, err := phyPayload.ValidateRejoinRequestMIC(device.SessionKeys().SNwkSIntKey, device.NwkKey)
+	if err != nil {
+		fields["lorawan error"] = err.Error()
+		return fields
+	}
+	fields["mic_valid"] = ok
+
+	return fields
+}
@@ -0,0 +1,147 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/bullettime/lora-logger/keystore"
+	"github.com/bullettime/lora-logger/lorawan"
+)
+
+// newTestDecrypter returns a decrypter with the devices of the testdata key
+// store.
+func newTestDecrypter(t *testing.T, file string) *Decrypter {
+	keys, err := keystore.Load(file)
+	if err != nil {
+		t.Fatalf("load keys failed: %v", err)
+	}
+	return NewDecrypter(keys, nil)
+}
+
+// TestDecryptRXPK decrypts the lora-packet example frame: FRMPayload "test"
+// on port 1 of device 49BE7DF1, and the LoRaWAN 1.1 vector of the lorawan
+// package: FRMPayload "hi" with encrypted FOpts of device 260B1234.
+func TestDecryptRXPK(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		fields  log.Fields
+		missing []string
+	}{
+		{"valid mic", "QPF9vkkAAgABlUN4disR/w0=", log.Fields{
+			"mic_valid":   true,
+			"decrypted":   true,
+			"frm payload": "74657374",
+			"mac version": "1.0",
+		}, nil},
+		{"invalid mic", "QPF9vkkAAgABlUN4disR/w4=", log.Fields{
+			"mic_valid":   false,
+			"decrypted":   false,
+			"frm payload": "95437876",
+		}, []string{"dev eui"}},
+		{"unknown device", "QAECAwQAAgABlUN4dqq7zN0=", log.Fields{
+			"decrypted": false,
+		}, []string{"mic_valid", "dev eui"}},
+		{"lorawan 1.1", "QDQSCyYjBQDsbOcBGG3NHSyn", log.Fields{
+			"mic_valid":   true,
+			"decrypted":   true,
+			"fopts":       "030702",
+			"frm payload": "6869",
+			"mac version": "1.1",
+		}, []string{"fopts encrypted"}},
+		{"lorawan 1.1 with invalid mic", "QDQSCyYjBQDsbOcBGG3NHSyo", log.Fields{
+			"mic_valid":       false,
+			"fopts":           "EC6CE7",
+			"fopts encrypted": true,
+		}, []string{"mac commands", "mac commands error"}},
+	}
+
+	d := newTestDecrypter(t, "testdata/devices.yaml")
+	for _, test := range tests {
+		rxpk := RXPK{Freq: 868.1, Data: test.data}
+		d.DecryptRXPK(&rxpk)
+
+		for k, v := range test.fields {
+			if rxpk.Frame[k] != v {
+				t.Errorf("%s: %s is %v, expected %v", test.name, k, rxpk.Frame[k], v)
+			}
+		}
+		for _, k := range test.missing {
+			if v, ok := rxpk.Frame[k]; ok {
+				t.Errorf("%s: unexpected %s %v", test.name, k, v)
+			}
+		}
+	}
+}
+
+// TestDecryptJoin uses the join vectors of the lorawan package: device
+// 0004A30B001C0532 joins and receives DevAddr 26011BDA.
+func TestDecryptJoin(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		fields  log.Fields
+		missing []string
+	}{
+		{"join request", "testdata/devices.yaml", "AAAAANB+1bNwMgUcAAujBAA0Emw5ONQ=", log.Fields{
+			"mic_valid":   true,
+			"mac version": "1.0",
+		}, nil},
+		{"join request with invalid mic", "testdata/devices.yaml", "AAAAANB+1bNwMgUcAAujBAA0Emw5ONU=", log.Fields{
+			"mic_valid": false,
+		}, nil},
+		{"join request of unknown device", "testdata/sessions.yaml", "AAAAANB+1bNwMgUcAAujBAA0Emw5ONQ=", nil, []string{"mic_valid"}},
+		{"join accept", "testdata/devices.yaml", "IGZsfed51qHNM0gA7HwJTbE=", log.Fields{
+			"mic_valid":      true,
+			"device address": lorawan.DevAddr{0x26, 0x01, 0x1B, 0xDA},
+			"mac version":    "1.0",
+		}, nil},
+		{"join accept with invalid mic", "testdata/devices.yaml", "IGZsfed51qHNM0gA7HwJTbI=", log.Fields{
+			"mic_valid": false,
+			"encrypted": true,
+		}, []string{"dev eui"}},
+		{"join accept without join keys", "testdata/sessions.yaml", "IGZsfed51qHNM0gA7HwJTbE=", log.Fields{
+			"encrypted": true,
+		}, []string{"mic_valid"}},
+	}
+
+	for _, test := range tests {
+		d := newTestDecrypter(t, test.file)
+		rxpk := RXPK{Freq: 868.1, Data: test.data}
+		d.DecryptRXPK(&rxpk)
+
+		for k, v := range test.fields {
+			if rxpk.Frame[k] != v {
+				t.Errorf("%s: %s is %v, expected %v", test.name, k, rxpk.Frame[k], v)
+			}
+		}
+		for _, k := range test.missing {
+			if v, ok := rxpk.Frame[k]; ok {
+				t.Errorf("%s: unexpected %s %v", test.name, k, v)
+			}
+		}
+	}
+}
@@ -25,6 +25,8 @@
 package protocol
 
 import (
+	"encoding"
+	"encoding/binary"
 	"fmt"
 
 	"github.com/apex/log"
@@ -44,13 +46,54 @@ const (
 	TXAck
 )
 
+// Direction defines whether a packet travels from the gateway to the server
+// or the other way around.
+type Direction byte
+
+// Available directions
+const (
+	Uplink Direction = iota
+	Downlink
+)
+
+// String implements the stringer interface for Direction.
+func (d Direction) String() string {
+	switch d {
+	case Uplink:
+		return "uplink"
+	case Downlink:
+		return "downlink"
+	default:
+		return fmt.Sprintf("Direction(%d)", d)
+	}
+}
+
 // Protocol version
 const (
 	ProtoVersion1 uint8 = 0x01
 	ProtoVersion2 uint8 = 0x02
 )
 
+// Packet is implemented by all packet types of the Semtech UDP protocol.
+// Every packet can be encoded back to its binary form, decoding the result
+// with HandlePacket yields an equal packet.
 type Packet interface {
+	encoding.BinaryMarshaler
+
+	// Type returns the packet identifier.
+	Type() PacketType
+	// ProtocolVersion returns the protocol version of the packet.
+	ProtocolVersion() uint8
+	// Token returns the random token used to pair a packet with its
+	// acknowledgement.
+	Token() uint16
+	// GatewayEUI returns the gateway identifier, ok is false when the
+	// packet does not carry one.
+	GatewayEUI() (eui [8]byte, ok bool)
+	// Direction returns whether the packet is sent by the gateway (uplink)
+	// or by the server (downlink).
+	Direction() Direction
+
 	Log(ctx log.Interface)
 }
 
@@ -104,3 +147,22 @@ func isValidPacket(data []byte) (bool, error) {
 
 	return true, nil
 }
+
+// marshalHeader returns the protocol version, random token and packet
+// identifier that start every packet.
+func marshalHeader(protocol uint8, randomToken uint16, pType PacketType) []byte {
+	header := make([]byte, 4)
+	header[0] = protocol
+	binary.LittleEndian.PutUint16(header[1:3], randomToken)
+	header[3] = byte(pType)
+	return header
+}
+
+// isPacketType checks that data carries the given packet identifier.
+func isPacketType(data []byte, pType PacketType) (bool, error) {
+	if PacketType(data[3]) != pType {
+		return false, errors.New(fmt.Sprintf("invalid packet: %s identifier expected", pType))
+	}
+
+	return true, nil
+}
@@ -0,0 +1,211 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// forwarderHeader returns the header of a datagram with the random token
+// 0x1234 and, for packets sent by the gateway, the gateway EUI.
+func forwarderHeader(pType PacketType, gateway bool) []byte {
+	data := []byte{ProtoVersion2, 0x34, 0x12, byte(pType)}
+	if gateway {
+		data = append(data, 0xaa, 0x55, 0x5a, 0x00, 0x00, 0x00, 0x01, 0x01)
+	}
+	return data
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"PUSH_DATA", append(forwarderHeader(PushData, true), []byte(`{"rxpk":[{"tmst":3512348611,"chan":2,"rfch":0,"freq":866.349812,"stat":1,"modu":"LORA","datr":"SF7BW125","codr":"4/6","lsnr":5.1,"rssi":-35,"size":23,"data":"QAQDAgGAAQABpkzNDKJrRgYwUYcL"}]}`)...)},
+		{"PUSH_DATA with time and stat", append(forwarderHeader(PushData, true), []byte(`{"rxpk":[{"time":"2013-03-31T16:21:17.528002Z","tmst":3512348611,"chan":0,"rfch":1,"freq":868.1,"stat":1,"modu":"LORA","datr":"SF12BW125","codr":"4/5","lsnr":-12.5,"rssi":-118,"size":23,"data":"gAQDAgEAAQAB0PH4o1xAv2Ezm8c="}],"stat":{"time":"2014-01-12 08:59:28 GMT","lati":46.24000,"long":3.25230,"alti":145,"rxnb":2,"rxok":2,"rxfw":2,"ackr":100.0,"dwnb":2,"txnb":2}}`)...)},
+		{"PUSH_DATA FSK", append(forwarderHeader(PushData, true), []byte(`{"rxpk":[{"tmst":3512348514,"chan":9,"rfch":1,"freq":869.1,"stat":1,"modu":"FSK","datr":50000,"rssi":-75,"size":16,"data":"VEVTVF9QQUNLRVRfMTIzNA=="}]}`)...)},
+		{"PUSH_DATA with invalid data rates", append(forwarderHeader(PushData, true), []byte(`{"rxpk":[{"tmst":3512348611,"chan":0,"rfch":0,"freq":2425.0,"stat":1,"modu":"LORA","datr":"SF12BW812","codr":"4/8","lsnr":7.0,"rssi":-70,"size":3,"data":"AQID"},{"tmst":3512348612,"chan":1,"rfch":0,"freq":868.3,"stat":1,"modu":"LORA","datr":"SF7BW62.5","codr":"4/5","lsnr":7.0,"rssi":-70,"size":3,"data":"AQID"},{"tmst":3512348613,"chan":2,"rfch":0,"freq":868.5,"stat":1,"modu":"LORA","datr":"LR-FHSS","rssi":-70,"size":3,"data":"AQID"}],"stat":{"time":"2014-01-12 08:59:28 GMT","lati":0,"long":0,"alti":0,"rxnb":3,"rxok":3,"rxfw":3,"ackr":0,"dwnb":0,"txnb":0}}`)...)},
+		{"PUSH_ACK", forwarderHeader(PushAck, false)},
+		{"PULL_DATA", forwarderHeader(PullData, true)},
+		{"PULL_ACK", forwarderHeader(PullAck, false)},
+		{"PULL_RESP", append(forwarderHeader(PullResp, false), []byte(`{"txpk":{"imme":false,"tmst":3513348611,"freq":869.525,"rfch":0,"powe":14,"modu":"LORA","datr":"SF9BW125","codr":"4/5","ipol":true,"size":17,"data":"YAQDAgEgAQABuVx9Dv4="}}`)...)},
+		{"TX_ACK", append(forwarderHeader(TXAck, true), []byte(`{"txpk_ack":{"error":"NONE"}}`)...)},
+		{"TX_ACK rejected", append(forwarderHeader(TXAck, true), []byte(`{"txpk_ack":{"error":"TOO_LATE"}}`)...)},
+		{"TX_ACK without payload", forwarderHeader(TXAck, true)},
+		{"TX_ACK with unknown status", append(forwarderHeader(TXAck, true), []byte(`{"txpk_ack":{"error":"TX_POWER_TOO_HIGH","warn":"TX_FREQ_NEW"}}`)...)},
+		{"TX_ACK with warning value", append(forwarderHeader(TXAck, true), []byte(`{"txpk_ack":{"error":"NONE","warn":"TX_POWER","value":20}}`)...)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := HandlePacket(test.data)
+			if err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+
+			data, err := p.MarshalBinary()
+			if err != nil {
+				t.Fatalf("encode failed: %v", err)
+			}
+
+			q, err := HandlePacket(data)
+			if err != nil {
+				t.Fatalf("decode of encoded packet failed: %v", err)
+			}
+			if !reflect.DeepEqual(p, q) {
+				t.Errorf("round trip changed the packet:\n%+v\n%+v", p, q)
+			}
+
+			again, err := q.MarshalBinary()
+			if err != nil {
+				t.Fatalf("encode of decoded packet failed: %v", err)
+			}
+			if !bytes.Equal(data, again) {
+				t.Errorf("encoding is not stable:\n%s\n%s", data, again)
+			}
+		})
+	}
+}
+
+// TestPacketEncoding checks that packets in the encoding of the packet
+// forwarder are re-encoded byte for byte.
+func TestPacketEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"PUSH_DATA stat", append(forwarderHeader(PushData, true), []byte(`{"stat":{"time":"2014-01-12 08:59:28 GMT","lati":46.24,"long":3.2523,"alti":145,"rxnb":2,"rxok":2,"rxfw":2,"ackr":100,"dwnb":2,"txnb":2}}`)...)},
+		{"PUSH_DATA FSK without snr", append(forwarderHeader(PushData, true), []byte(`{"rxpk":[{"tmst":3512348514,"freq":869.1,"chan":9,"rfch":1,"stat":1,"modu":"FSK","datr":50000,"rssi":-75,"size":16,"data":"VEVTVF9QQUNLRVRfMTIzNA=="}]}`)...)},
+		{"PUSH_DATA LoRa", append(forwarderHeader(PushData, true), []byte(`{"rxpk":[{"time":"2013-03-31T16:21:17.528002Z","tmst":3512348611,"freq":868.1,"chan":0,"rfch":1,"stat":1,"modu":"LORA","datr":"SF12BW125","codr":"4/5","rssi":-118,"lsnr":-12.5,"size":23,"data":"gAQDAgEAAQAB0PH4o1xAv2Ezm8c="}]}`)...)},
+	}
+
+	for _, test := range tests {
+		p, err := HandlePacket(test.data)
+		if err != nil {
+			t.Errorf("%s: decode failed: %v", test.name, err)
+			continue
+		}
+		data, err := p.MarshalBinary()
+		if err != nil {
+			t.Errorf("%s: encode failed: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(data, test.data) {
+			t.Errorf("%s: encoded as %s, expected %s", test.name, data[12:], test.data[12:])
+		}
+	}
+}
+
+func TestPacketOptionalFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		pType   PacketType
+		gateway bool
+		payload string
+	}{
+		{"PUSH_DATA with zero values and without time", PushData, true, `{"rxpk":[{"tmst":0,"chan":0,"rfch":0,"brd":0,"ant":0,"aesk":0,"freq":868.1,"stat":1,"modu":"LORA","datr":"SF7BW125","codr":"4/5","lsnr":0,"rssi":-60,"rssis":0,"rssic":0,"foff":0,"size":3,"data":"AQID"}]}`},
+		{"PUSH_DATA with GPS time", PushData, true, `{"rxpk":[{"time":"2013-03-31T16:21:17.528002Z","tmms":0,"tmst":1,"chan":0,"rfch":0,"freq":868.1,"stat":1,"modu":"LORA","datr":"SF7BW125","codr":"4/5","lsnr":0,"rssi":-60,"size":3,"data":"AQID"}]}`},
+		{"PUSH_DATA LR-FHSS and coding rate off", PushData, true, `{"rxpk":[{"tmst":3512348611,"chan":0,"rfch":0,"freq":868.1,"stat":1,"modu":"LR-FHSS","datr":"M0CW137","codr":"2/3","lsnr":-3.5,"rssi":-60,"size":3,"data":"AQID"},{"tmst":3512348612,"chan":9,"rfch":1,"freq":868.8,"stat":1,"modu":"FSK","datr":50000,"codr":"OFF","lsnr":0,"rssi":-60,"size":3,"data":"AQID"}]}`},
+		{"PULL_RESP with zero values", PullResp, false, `{"txpk":{"imme":false,"tmst":0,"freq":869.525,"rfch":0,"powe":14,"brd":0,"ant":0,"modu":"LORA","datr":"SF9BW125","codr":"4/5","ipol":true,"size":3,"data":"AQID"}}`},
+		{"PULL_RESP without timestamp", PullResp, false, `{"txpk":{"imme":true,"freq":869.525,"rfch":0,"powe":14,"modu":"LORA","datr":"SF9BW125","codr":"4/5","ipol":true,"size":3,"data":"AQID"}}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := forwarderHeader(test.pType, test.gateway)
+			p, err := HandlePacket(append(header, []byte(test.payload)...))
+			if err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+
+			data, err := p.MarshalBinary()
+			if err != nil {
+				t.Fatalf("encode failed: %v", err)
+			}
+
+			var want, got interface{}
+			if err := json.Unmarshal([]byte(test.payload), &want); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(data[len(header):], &got); err != nil {
+				t.Fatalf("encoded payload is not valid JSON: %v", err)
+			}
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("re-encoding changed the payload:\n%s\n%s", test.payload, data[len(header):])
+			}
+		})
+	}
+}
+
+func TestRXPKUnrecognisedCodingRate(t *testing.T) {
+	data := append(forwarderHeader(PushData, true), []byte(`{"rxpk":[{"tmst":3512348611,"chan":0,"rfch":0,"freq":868.1,"stat":1,"modu":"LR-FHSS","datr":"M0CW137","codr":"2/3","rssi":-60,"size":3,"data":"AQID"},{"tmst":3512348612,"chan":1,"rfch":0,"freq":868.3,"stat":1,"modu":"LORA","datr":"SF7BW125","codr":"4/5","lsnr":7.0,"rssi":-60,"size":3,"data":"AQID"}]}`)...)
+
+	p, err := HandlePacket(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	rxpks := p.(*PushDataPacket).Payload.RXPK
+	if len(rxpks) != 2 {
+		t.Fatalf("%d rxpk decoded, expected 2", len(rxpks))
+	}
+
+	fields := rxpks[0].Fields()
+	if _, ok := fields["coding rate error"]; !ok {
+		t.Errorf("unrecognised coding rate not reported: %v", fields)
+	}
+	if s := rxpks[0].CodR.String(); s != "2/3" {
+		t.Errorf("coding rate %q, expected 2/3", s)
+	}
+
+	fields = rxpks[1].Fields()
+	if err, ok := fields["coding rate error"]; ok {
+		t.Errorf("valid coding rate reported: %v", err)
+	}
+}
+
+func TestTXAckExtra(t *testing.T) {
+	data := append(forwarderHeader(TXAck, true), []byte(`{"txpk_ack":{"error":"NONE","warn":"TX_POWER","value":20}}`)...)
+
+	p, err := HandlePacket(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	ack := p.(*TXAckPacket).Payload.TXPKACK
+	if ack.Error != TXAckNone || ack.Warn != TXAckTXPower {
+		t.Errorf("tx ack %s with warning %s, expected NONE with warning TX_POWER", ack.Error, ack.Warn)
+	}
+	if value := string(ack.Extra["value"]); value != "20" {
+		t.Errorf("extra value %q, expected 20", value)
+	}
+
+	encoded, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if !bytes.Equal(encoded, data) {
+		t.Errorf("encoded as %s, expected %s", encoded[12:], data[12:])
+	}
+}
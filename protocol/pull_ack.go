@@ -39,7 +39,7 @@ type PullAckPacket struct {
 func handlePullAck(data []byte) (Packet, error) {
 	var packet PullAckPacket
 
-	err := packet.unmarshalData(data)
+	err := packet.UnmarshalBinary(data)
 	if err != nil {
 		return nil, errors.Wrap(err, "handle pull ack packet failed")
 	}
@@ -47,6 +47,31 @@ func handlePullAck(data []byte) (Packet, error) {
 	return &packet, nil
 }
 
+// Type implements the Packet interface for PullAckPacket.
+func (p *PullAckPacket) Type() PacketType {
+	return PullAck
+}
+
+// ProtocolVersion implements the Packet interface for PullAckPacket.
+func (p *PullAckPacket) ProtocolVersion() uint8 {
+	return p.Protocol
+}
+
+// Token implements the Packet interface for PullAckPacket.
+func (p *PullAckPacket) Token() uint16 {
+	return p.RandomToken
+}
+
+// GatewayEUI implements the Packet interface for PullAckPacket.
+func (p *PullAckPacket) GatewayEUI() ([8]byte, bool) {
+	return [8]byte{}, false
+}
+
+// Direction implements the Packet interface for PullAckPacket.
+func (p *PullAckPacket) Direction() Direction {
+	return Downlink
+}
+
 func (p *PullAckPacket) Log(ctx log.Interface) {
 	ctx.WithFields(log.Fields{
 		"protocol":     p.Protocol,
@@ -54,7 +79,13 @@ func (p *PullAckPacket) Log(ctx log.Interface) {
 	}).Info("PULL_ACK")
 }
 
-func (p *PullAckPacket) unmarshalData(data []byte) error {
+// MarshalBinary implements the encoding.BinaryMarshaler interface for PullAckPacket.
+func (p *PullAckPacket) MarshalBinary() ([]byte, error) {
+	return marshalHeader(p.Protocol, p.RandomToken, PullAck), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for PullAckPacket.
+func (p *PullAckPacket) UnmarshalBinary(data []byte) error {
 	_, err := isValidPullAckPacket(data)
 	if err != nil {
 		return errors.Wrap(err, "unmarshal pull ack packet failed")
@@ -71,5 +102,5 @@ func isValidPullAckPacket(data []byte) (bool, error) {
 		return false, errors.New("invalid packet: 4 bytes expected")
 	}
 
-	return true, nil
+	return isPacketType(data, PullAck)
 }
@@ -40,7 +40,7 @@ type PullDataPacket struct {
 func handlePullData(data []byte) (Packet, error) {
 	var packet PullDataPacket
 
-	err := packet.unmarshalData(data)
+	err := packet.UnmarshalBinary(data)
 	if err != nil {
 		return nil, errors.Wrap(err, "handle pull data packet failed")
 	}
@@ -48,6 +48,31 @@ func handlePullData(data []byte) (Packet, error) {
 	return &packet, nil
 }
 
+// Type implements the Packet interface for PullDataPacket.
+func (p *PullDataPacket) Type() PacketType {
+	return PullData
+}
+
+// ProtocolVersion implements the Packet interface for PullDataPacket.
+func (p *PullDataPacket) ProtocolVersion() uint8 {
+	return p.Protocol
+}
+
+// Token implements the Packet interface for PullDataPacket.
+func (p *PullDataPacket) Token() uint16 {
+	return p.RandomToken
+}
+
+// GatewayEUI implements the Packet interface for PullDataPacket.
+func (p *PullDataPacket) GatewayEUI() ([8]byte, bool) {
+	return p.GatewayMac, true
+}
+
+// Direction implements the Packet interface for PullDataPacket.
+func (p *PullDataPacket) Direction() Direction {
+	return Uplink
+}
+
 func (p *PullDataPacket) Log(ctx log.Interface) {
 	ctx.WithFields(log.Fields{
 		"protocol":     p.Protocol,
@@ -56,7 +81,14 @@ func (p *PullDataPacket) Log(ctx log.Interface) {
 	}).Info("PULL_DATA")
 }
 
-func (p *PullDataPacket) unmarshalData(data []byte) error {
+// MarshalBinary implements the encoding.BinaryMarshaler interface for PullDataPacket.
+func (p *PullDataPacket) MarshalBinary() ([]byte, error) {
+	data := marshalHeader(p.Protocol, p.RandomToken, PullData)
+	return append(data, p.GatewayMac[:]...), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for PullDataPacket.
+func (p *PullDataPacket) UnmarshalBinary(data []byte) error {
 	_, err := isValidPullDataPacket(data)
 	if err != nil {
 		return errors.Wrap(err, "unmarshal pull data packet failed")
@@ -77,5 +109,5 @@ func isValidPullDataPacket(data []byte) (bool, error) {
 		return false, errors.New("invalid packet: 12 bytes expected")
 	}
 
-	return true, nil
+	return isPacketType(data, PullData)
 }
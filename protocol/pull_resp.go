@@ -43,29 +43,50 @@ type PullRespPayload struct {
 	TXPK TXPK `json:"txpk"`
 }
 
-// TXPK contains a RF packet to be emitted and associated metadata.
+// TXPK contains a RF packet to be emitted and associated metadata. Keys that
+// are not known are kept in Extra.
 type TXPK struct {
-	Imme bool     `json:"imme"`           // imme | bool   | Send packet immediately (will ignore tmst & time)
-	Tmst uint32   `json:"tmst,omitempty"` // tmst | number | Send packet on a certain timestamp value (will ignore time)
-	Tmms int64    `json:"tmms,omitempty"` // tmms | number | Send packet at a certain GPS time (GPS synchronization required)
-	Freq float64  `json:"freq"`           // freq | number | TX central frequency in MHz (unsigned float, Hz precision)
-	RFCh uint8    `json:"rfch"`           // rfch | number | Concentrator "RF chain" used for TX (unsigned integer)
-	Powe uint8    `json:"powe"`           // powe | number | TX output power in dBm (unsigned integer, dBm precision)
-	Modu string   `json:"modu"`           // modu | string | Modulation identifier "LORA" or "FSK"
-	DatR DataRate `json:"datr"`           // datr | string | LoRa datarate identifier (eg. SF12BW500) || datr | number | FSK datarate (unsigned, in bits per second)
-	CodR string   `json:"codr,omitempty"` // codr | string | LoRa ECC coding rate identifier
-	FDev uint16   `json:"fdev,omitempty"` // fdev | number | FSK frequency deviation (unsigned integer, in Hz)
-	IPol bool     `json:"ipol"`           // ipol | bool   | Lora modulation polarization inversion
-	Prea uint16   `json:"prea,omitempty"` // prea | number | RF preamble size (unsigned integer)
-	Size uint16   `json:"size"`           // size | number | RF packet payload size in bytes (unsigned integer)
-	Data string   `json:"data"`           // data | string | Base64 encoded RF packet payload, padding optional
-	NCRC bool     `json:"ncrc,omitempty"` // ncrc | bool   | If true, disable the CRC of the physical layer (optional)
+	Imme bool        `json:"imme"`           // imme | bool   | Send packet immediately (will ignore tmst & time)
+	Tmst *uint32     `json:"tmst,omitempty"` // tmst | number | Send packet on a certain timestamp value (will ignore time)
+	Tmms *int64      `json:"tmms,omitempty"` // tmms | number | Send packet at a certain GPS time (GPS synchronization required)
+	Freq float64     `json:"freq"`           // freq | number | TX central frequency in MHz (unsigned float, Hz precision)
+	RFCh uint8       `json:"rfch"`           // rfch | number | Concentrator "RF chain" used for TX (unsigned integer)
+	Powe uint8       `json:"powe"`           // powe | number | TX output power in dBm (unsigned integer, dBm precision)
+	Brd  *uint8      `json:"brd,omitempty"`  // brd  | number | Concentrator board used for TX (unsigned integer)
+	Ant  *uint8      `json:"ant,omitempty"`  // ant  | number | Antenna number used for TX (unsigned integer)
+	Modu string      `json:"modu"`           // modu | string | Modulation identifier "LORA" or "FSK"
+	DatR DataRate    `json:"datr"`           // datr | string | LoRa datarate identifier (eg. SF12BW500) || datr | number | FSK datarate (unsigned, in bits per second)
+	CodR *CodingRate `json:"codr,omitempty"` // codr | string | LoRa ECC coding rate identifier
+	FDev uint16      `json:"fdev,omitempty"` // fdev | number | FSK frequency deviation (unsigned integer, in Hz)
+	IPol bool        `json:"ipol"`           // ipol | bool   | Lora modulation polarization inversion
+	Prea uint16      `json:"prea,omitempty"` // prea | number | RF preamble size (unsigned integer)
+	Size uint16      `json:"size"`           // size | number | RF packet payload size in bytes (unsigned integer)
+	Data string      `json:"data"`           // data | string | Base64 encoded RF packet payload, padding optional
+	NCRC bool        `json:"ncrc,omitempty"` // ncrc | bool   | If true, disable the CRC of the physical layer (optional)
+
+	Extra  map[string]json.RawMessage `json:"-"`
+	Frame  log.Fields                 `json:"-"` // LoRaWAN frame decrypted by a Decrypter
+	Region log.Fields                 `json:"-"` // channel and data rate index set by a RegionAnnotator
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for TXPK.
+func (t *TXPK) UnmarshalJSON(data []byte) error {
+	type txpk TXPK
+	extra, err := unmarshalJSONExtra(data, (*txpk)(t))
+	t.Extra = extra
+	return err
+}
+
+// MarshalJSON implements the json.Marshaler interface for TXPK.
+func (t TXPK) MarshalJSON() ([]byte, error) {
+	type txpk TXPK
+	return marshalJSONExtra(txpk(t), t.Extra)
 }
 
 func handlePullResp(data []byte) (Packet, error) {
 	var pullRespPacket PullRespPacket
 
-	err := pullRespPacket.unmarshalData(data)
+	err := pullRespPacket.UnmarshalBinary(data)
 	if err != nil {
 		return nil, errors.Wrap(err, "handle pull resp packet failed")
 	}
@@ -73,13 +94,36 @@ func handlePullResp(data []byte) (Packet, error) {
 	return &pullRespPacket, nil
 }
 
+// Type implements the Packet interface for PullRespPacket.
+func (p *PullRespPacket) Type() PacketType {
+	return PullResp
+}
+
+// ProtocolVersion implements the Packet interface for PullRespPacket.
+func (p *PullRespPacket) ProtocolVersion() uint8 {
+	return p.Protocol
+}
+
+// Token implements the Packet interface for PullRespPacket.
+func (p *PullRespPacket) Token() uint16 {
+	return p.RandomToken
+}
+
+// GatewayEUI implements the Packet interface for PullRespPacket.
+func (p *PullRespPacket) GatewayEUI() ([8]byte, bool) {
+	return [8]byte{}, false
+}
+
+// Direction implements the Packet interface for PullRespPacket.
+func (p *PullRespPacket) Direction() Direction {
+	return Downlink
+}
+
 func (p *PullRespPacket) Log(ctx log.Interface) {
-	ctx.WithFields(log.Fields{
+	fields := log.Fields{
 		"protocol":               p.Protocol,
 		"random token":           p.RandomToken,
 		"immediately":            p.Payload.TXPK.Imme,
-		"timestamp":              p.Payload.TXPK.Tmst,
-		"gps time":               p.Payload.TXPK.Tmms,
 		"frequency":              p.Payload.TXPK.Freq,
 		"RF chain":               p.Payload.TXPK.RFCh,
 		"power":                  p.Payload.TXPK.Powe,
@@ -91,10 +135,57 @@ func (p *PullRespPacket) Log(ctx log.Interface) {
 		"no crc":                 p.Payload.TXPK.NCRC,
 		"size":                   p.Payload.TXPK.Size,
 		"data":                   p.Payload.TXPK.Data,
-	}).Info("PULL_RESP")
+	}
+	if p.Payload.TXPK.Tmst != nil {
+		fields["timestamp"] = *p.Payload.TXPK.Tmst
+	}
+	if p.Payload.TXPK.Tmms != nil {
+		fields["gps time"] = *p.Payload.TXPK.Tmms
+	}
+	if p.Payload.TXPK.Brd != nil {
+		fields["board"] = *p.Payload.TXPK.Brd
+	}
+	if p.Payload.TXPK.Ant != nil {
+		fields["antenna"] = *p.Payload.TXPK.Ant
+	}
+
+	ctx.WithFields(fields).WithFields(dataRateFields(&p.Payload.TXPK.DatR)).
+		WithFields(codingRateFields(p.Payload.TXPK.CodR)).
+		WithFields(airtimeFields(p.Payload.TXPK.Airtime())).
+		WithFields(p.Payload.TXPK.Region).
+		WithFields(extraFields(p.Payload.TXPK.Extra)).
+		WithFields(frameFields(p.Payload.TXPK.Frame, p.Payload.TXPK.Data)).Info("PULL_RESP")
+}
+
+// DownlinkFields returns the fields identifying the downlink, they are
+// added to the TX_ACK that acknowledges it.
+func (p *PullRespPacket) DownlinkFields() log.Fields {
+	fields := log.Fields{
+		"downlink token":     p.RandomToken,
+		"downlink frequency": p.Payload.TXPK.Freq,
+		"downlink data rate": p.Payload.TXPK.DatR,
+		"downlink size":      p.Payload.TXPK.Size,
+	}
+	if p.Payload.TXPK.Tmst != nil {
+		fields["downlink timestamp"] = *p.Payload.TXPK.Tmst
+	}
+	return fields
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface for PullRespPacket.
+func (p *PullRespPacket) MarshalBinary() ([]byte, error) {
+	data := marshalHeader(p.Protocol, p.RandomToken, PullResp)
+
+	payload, err := json.Marshal(p.Payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal pull resp packet failed")
+	}
+
+	return append(data, payload...), nil
 }
 
-func (p *PullRespPacket) unmarshalData(data []byte) error {
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for PullRespPacket.
+func (p *PullRespPacket) UnmarshalBinary(data []byte) error {
 	_, err := isValidPullRespPacket(data)
 	if err != nil {
 		return errors.Wrap(err, "unmarshal pull resp packet failed")
@@ -111,5 +202,5 @@ func isValidPullRespPacket(data []byte) (bool, error) {
 		return false, errors.New("invalid packet: at least 4 bytes expected")
 	}
 
-	return true, nil
+	return isPacketType(data, PullResp)
 }
@@ -39,7 +39,7 @@ type PushAckPacket struct {
 func handlePushAck(data []byte) (Packet, error) {
 	var packet PushAckPacket
 
-	err := packet.unmarshalData(data)
+	err := packet.UnmarshalBinary(data)
 	if err != nil {
 		return nil, errors.Wrap(err, "handle push ack packet failed")
 	}
@@ -47,6 +47,31 @@ func handlePushAck(data []byte) (Packet, error) {
 	return &packet, nil
 }
 
+// Type implements the Packet interface for PushAckPacket.
+func (p *PushAckPacket) Type() PacketType {
+	return PushAck
+}
+
+// ProtocolVersion implements the Packet interface for PushAckPacket.
+func (p *PushAckPacket) ProtocolVersion() uint8 {
+	return p.Protocol
+}
+
+// Token implements the Packet interface for PushAckPacket.
+func (p *PushAckPacket) Token() uint16 {
+	return p.RandomToken
+}
+
+// GatewayEUI implements the Packet interface for PushAckPacket.
+func (p *PushAckPacket) GatewayEUI() ([8]byte, bool) {
+	return [8]byte{}, false
+}
+
+// Direction implements the Packet interface for PushAckPacket.
+func (p *PushAckPacket) Direction() Direction {
+	return Downlink
+}
+
 func (p *PushAckPacket) Log(ctx log.Interface) {
 	ctx.WithFields(log.Fields{
 		"protocol":     p.Protocol,
@@ -54,7 +79,13 @@ func (p *PushAckPacket) Log(ctx log.Interface) {
 	}).Info("PUSH_ACK")
 }
 
-func (p *PushAckPacket) unmarshalData(data []byte) error {
+// MarshalBinary implements the encoding.BinaryMarshaler interface for PushAckPacket.
+func (p *PushAckPacket) MarshalBinary() ([]byte, error) {
+	return marshalHeader(p.Protocol, p.RandomToken, PushAck), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for PushAckPacket.
+func (p *PushAckPacket) UnmarshalBinary(data []byte) error {
 	_, err := isValidPushAckPacket(data)
 	if err != nil {
 		return errors.Wrap(err, "unmarshal push ack packet failed")
@@ -71,5 +102,5 @@ func isValidPushAckPacket(data []byte) (bool, error) {
 		return false, errors.New("invalid packet: 4 bytes expected")
 	}
 
-	return true, nil
+	return isPacketType(data, PushAck)
 }
@@ -26,8 +26,6 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/apex/log"
@@ -49,45 +47,107 @@ type PushDataPayload struct {
 	Stat *Stat  `json:"stat,omitempty"`
 }
 
-// RXPK contains an RF packet and associated metadata.
+// RXPK contains an RF packet and associated metadata. Keys that are not
+// known are kept in Extra.
 type RXPK struct {
-	Time CompactTime `json:"time"` // time | string | UTC time of pkt RX, us precision, ISO 8601 'compact' format
-	TMMS int64       `json:"tmms"` // tmms | number | GPS time of pkt RX, number of milliseconds since 06.Jan.1980
-	TMST uint32      `json:"tmst"` // tmst | number | Internal timestamp of "RX finished" event (32b unsigned)
-	Freq float64     `json:"freq"` // freq | number | RX central frequency in MHz (unsigned float, Hz precision)
-	Chan uint8       `json:"chan"` // chan | number | Concentrator "IF" channel used for RX (unsigned integer)
-	RFCh uint8       `json:"rfch"` // rfch | number | Concentrator "RF chain" used for RX (unsigned integer)
-	Stat int8        `json:"stat"` // stat | number | CRC status: 1 = OK, -1 = fail, 0 = no CRC
-	Mod  string      `json:"modu"` // modu | string | Modulation identifier "LORA" or "FSK"
-	DatR *DataRate   `json:"datr"` // datr | string | LoRa datarate identifier (eg. SF12BW500) || datr | number | FSK datarate (unsigned, in bits per second)
-	CodR string      `json:"codr"` // codr | string | LoRa ECC coding rate identifier
-	RSSI int16       `json:"rssi"` // rssi | number | RSSI in dBm (signed integer, 1 dB precision)
-	SNR  float64     `json:"lsnr"` // lsnr | number | Lora SNR ratio in dB (signed float, 0.1 dB precision)
-	Size uint16      `json:"size"` // size | number | RF packet payload size in bytes (unsigned integer)
-	Data string      `json:"data"` // data | string | Base64 encoded RF packet payload, padded
-}
-
-// Stat contains the status of the gateway.
+	Time  *CompactTime `json:"time,omitempty"`  // time  | string | UTC time of pkt RX, us precision, ISO 8601 'compact' format
+	TMMS  *int64       `json:"tmms,omitempty"`  // tmms  | number | GPS time of pkt RX, number of milliseconds since 06.Jan.1980
+	TMST  uint32       `json:"tmst"`            // tmst  | number | Internal timestamp of "RX finished" event (32b unsigned)
+	Freq  float64      `json:"freq"`            // freq  | number | RX central frequency in MHz (unsigned float, Hz precision)
+	Chan  uint8        `json:"chan"`            // chan  | number | Concentrator "IF" channel used for RX (unsigned integer)
+	RFCh  uint8        `json:"rfch"`            // rfch  | number | Concentrator "RF chain" used for RX (unsigned integer)
+	Brd   *uint8       `json:"brd,omitempty"`   // brd   | number | Concentrator board used for RX (unsigned integer)
+	Ant   *uint8       `json:"ant,omitempty"`   // ant   | number | Antenna number on which signal has been received (unsigned integer)
+	AESK  *uint8       `json:"aesk,omitempty"`  // aesk  | number | AES key index used for encrypting fine timestamps
+	Stat  int8         `json:"stat"`            // stat  | number | CRC status: 1 = OK, -1 = fail, 0 = no CRC
+	Mod   string       `json:"modu"`            // modu  | string | Modulation identifier "LORA" or "FSK"
+	DatR  *DataRate    `json:"datr"`            // datr  | string | LoRa datarate identifier (eg. SF12BW500) || datr | number | FSK datarate (unsigned, in bits per second)
+	CodR  *CodingRate  `json:"codr,omitempty"`  // codr  | string | LoRa ECC coding rate identifier
+	RSSI  int16        `json:"rssi"`            // rssi  | number | RSSI in dBm (signed integer, 1 dB precision)
+	RSSIS *int16       `json:"rssis,omitempty"` // rssis | number | RSSI of the signal in dBm (signed integer, 1 dB precision)
+	RSSIC *int16       `json:"rssic,omitempty"` // rssic | number | RSSI of the channel in dBm (signed integer, 1 dB precision)
+	SNR   *float64     `json:"lsnr,omitempty"`  // lsnr  | number | Lora SNR ratio in dB (signed float, 0.1 dB precision)
+	FOff  *int32       `json:"foff,omitempty"`  // foff  | number | LoRa frequency offset in Hz (signed integer)
+	Size  uint16       `json:"size"`            // size  | number | RF packet payload size in bytes (unsigned integer)
+	Data  string       `json:"data"`            // data  | string | Base64 encoded RF packet payload, padded
+	RSig  []RSig       `json:"rsig,omitempty"`  // rsig  | array  | Signal information per antenna
+
+	Extra  map[string]json.RawMessage `json:"-"`
+	Frame  log.Fields                 `json:"-"` // LoRaWAN frame decrypted by a Decrypter
+	Region log.Fields                 `json:"-"` // channel and data rate index set by a RegionAnnotator
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for RXPK.
+func (r *RXPK) UnmarshalJSON(data []byte) error {
+	type rxpk RXPK
+	extra, err := unmarshalJSONExtra(data, (*rxpk)(r))
+	r.Extra = extra
+	return err
+}
+
+// MarshalJSON implements the json.Marshaler interface for RXPK.
+func (r RXPK) MarshalJSON() ([]byte, error) {
+	type rxpk RXPK
+	return marshalJSONExtra(rxpk(r), r.Extra)
+}
+
+// RSig contains the signal information of a single antenna.
+type RSig struct {
+	Ant     uint8   `json:"ant"`               // ant     | number | Antenna number on which signal has been received
+	Chan    uint8   `json:"chan"`              // chan    | number | Concentrator "IF" channel used for RX (unsigned integer)
+	RSSIC   int16   `json:"rssic"`             // rssic   | number | RSSI of the channel in dBm (signed integer, 1 dB precision)
+	RSSIS   int16   `json:"rssis,omitempty"`   // rssis   | number | RSSI of the signal in dBm (signed integer, 1 dB precision)
+	RSSISD  uint16  `json:"rssisd,omitempty"`  // rssisd  | number | Standard deviation of RSSI during preamble (unsigned integer)
+	LSNR    float64 `json:"lsnr,omitempty"`    // lsnr    | number | Lora SNR ratio in dB (signed float, 0.1 dB precision)
+	ETime   string  `json:"etime,omitempty"`   // etime   | string | Encrypted fine timestamp, ns precision [0..999999999] (Base64)
+	FOff    int32   `json:"foff,omitempty"`    // foff    | number | Frequency offset in Hz (signed integer)
+	FTStat  int8    `json:"ftstat,omitempty"`  // ftstat  | number | Fine timestamp status
+	FTVer   uint8   `json:"ftver,omitempty"`   // ftver   | number | Version of the fine timestamp algorithm
+	FTDelta int32   `json:"ftdelta,omitempty"` // ftdelta | number | Number of nanoseconds between the fine timestamp and the internal timestamp
+}
+
+// Stat contains the status of the gateway. Keys that are not known are kept
+// in Extra.
 type Stat struct {
-	Time ExpandedTime `json:"time"` // time | string | UTC 'system' time of the gateway, ISO 8601 'expanded' format
-	Lati float64      `json:"lati"` // lati | number | GPS latitude of the gateway in degree (float, N is +)
-	Long float64      `json:"long"` // long | number | GPS latitude of the gateway in degree (float, E is +)
-	Alti int32        `json:"alti"` // alti | number | GPS altitude of the gateway in meter RX (integer)
-	RXNb uint32       `json:"rxnb"` // rxnb | number | Number of radio packets received (unsigned integer)
-	RXOK uint32       `json:"rxok"` // rxok | number | Number of radio packets received with a valid PHY CRC
-	RXFW uint32       `json:"rxfw"` // rxfw | number | Number of radio packets forwarded (unsigned integer)
-	ACKR float64      `json:"ackr"` // ackr | number | Percentage of upstream datagrams that were acknowledged
-	DWNb uint32       `json:"dwnb"` // dwnb | number | Number of downlink datagrams received (unsigned integer)
-	TXNb uint32       `json:"txnb"` // txnb | number | Number of packets emitted (unsigned integer)
+	Time ExpandedTime `json:"time"`           // time | string | UTC 'system' time of the gateway, ISO 8601 'expanded' format
+	Lati float64      `json:"lati"`           // lati | number | GPS latitude of the gateway in degree (float, N is +)
+	Long float64      `json:"long"`           // long | number | GPS latitude of the gateway in degree (float, E is +)
+	Alti int32        `json:"alti"`           // alti | number | GPS altitude of the gateway in meter RX (integer)
+	RXNb uint32       `json:"rxnb"`           // rxnb | number | Number of radio packets received (unsigned integer)
+	RXOK uint32       `json:"rxok"`           // rxok | number | Number of radio packets received with a valid PHY CRC
+	RXFW uint32       `json:"rxfw"`           // rxfw | number | Number of radio packets forwarded (unsigned integer)
+	ACKR float64      `json:"ackr"`           // ackr | number | Percentage of upstream datagrams that were acknowledged
+	DWNb uint32       `json:"dwnb"`           // dwnb | number | Number of downlink datagrams received (unsigned integer)
+	TXNb uint32       `json:"txnb"`           // txnb | number | Number of packets emitted (unsigned integer)
+	Pfrm string       `json:"pfrm,omitempty"` // pfrm | string | Platform definition
+	Mail string       `json:"mail,omitempty"` // mail | string | Email of gateway operator
+	Desc string       `json:"desc,omitempty"` // desc | string | Public description of this device
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for Stat.
+func (s *Stat) UnmarshalJSON(data []byte) error {
+	type stat Stat
+	extra, err := unmarshalJSONExtra(data, (*stat)(s))
+	s.Extra = extra
+	return err
+}
+
+// MarshalJSON implements the json.Marshaler interface for Stat.
+func (s Stat) MarshalJSON() ([]byte, error) {
+	type stat Stat
+	return marshalJSONExtra(stat(s), s.Extra)
 }
 
 // ExpandedTime implements time.Time but (un)marshals to and from
-// ISO 8601 'expanded' format.
+// ISO 8601 'expanded' format. It is always sent in UTC with the GMT zone, as
+// the packet forwarder does.
 type ExpandedTime time.Time
 
 // MarshalJSON implements the json.Marshaler interface for ExpandedTime.
 func (t ExpandedTime) MarshalJSON() ([]byte, error) {
-	return []byte(time.Time(t).UTC().Format(`"2006-01-02 15:04:05 MST"`)), nil
+	return []byte(time.Time(t).UTC().Format(`"2006-01-02 15:04:05 GMT"`)), nil
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface for ExpandedTime.
@@ -96,7 +156,7 @@ func (t *ExpandedTime) UnmarshalJSON(data []byte) error {
 	if err != nil {
 		return err
 	}
-	*t = ExpandedTime(t2)
+	*t = ExpandedTime(t2.UTC())
 	return nil
 }
 
@@ -119,50 +179,90 @@ func (t *CompactTime) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-// DataRate implements the data rate which can be either a string (LoRa identifier)
-// or an unsigned integer in case of FSK (bits per second).
-type DataRate struct {
-	LoRa string
-	FSK  uint32
-}
+func handlePushData(data []byte) (Packet, error) {
+	var pushDataPacket PushDataPacket
 
-// String implements the stringer interface for DataRate.
-func (d DataRate) String() string {
-	if d.LoRa != "" {
-		return d.LoRa
+	err := pushDataPacket.UnmarshalBinary(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "handle push data packet failed")
 	}
 
-	return string(d.FSK)
+	return &pushDataPacket, nil
 }
 
-// MarshalJSON implements the json.Marshaler interface for DataRate.
-func (d DataRate) MarshalJSON() ([]byte, error) {
-	if d.LoRa != "" {
-		return []byte(`"` + d.LoRa + `"`), nil
-	}
-	return []byte(strconv.FormatUint(uint64(d.FSK), 10)), nil
+// Type implements the Packet interface for PushDataPacket.
+func (p *PushDataPacket) Type() PacketType {
+	return PushData
 }
 
-// UnmarshalJSON implements the json.Unmarshaler interface for DataRate.
-func (d *DataRate) UnmarshalJSON(data []byte) error {
-	i, err := strconv.ParseUint(string(data), 10, 32)
-	if err != nil {
-		d.LoRa = strings.Trim(string(data), `"`)
-		return nil
-	}
-	d.FSK = uint32(i)
-	return nil
+// ProtocolVersion implements the Packet interface for PushDataPacket.
+func (p *PushDataPacket) ProtocolVersion() uint8 {
+	return p.Protocol
 }
 
-func handlePushData(data []byte) (Packet, error) {
-	var pushDataPacket PushDataPacket
+// Token implements the Packet interface for PushDataPacket.
+func (p *PushDataPacket) Token() uint16 {
+	return p.RandomToken
+}
 
-	err := pushDataPacket.unmarshalData(data)
-	if err != nil {
-		return nil, errors.Wrap(err, "handle push data packet failed")
+// GatewayEUI implements the Packet interface for PushDataPacket.
+func (p *PushDataPacket) GatewayEUI() ([8]byte, bool) {
+	return p.GatewayMac, true
+}
+
+// Direction implements the Packet interface for PushDataPacket.
+func (p *PushDataPacket) Direction() Direction {
+	return Uplink
+}
+
+// Fields returns the received packet, its time on air, channel and the
+// decoded LoRaWAN frame as log fields.
+func (rxpk *RXPK) Fields() log.Fields {
+	fields := log.Fields{
+		"frequency":   rxpk.Freq,
+		"IF channel":  rxpk.Chan,
+		"RF chain":    rxpk.RFCh,
+		"crc":         rxpk.Stat,
+		"modulation":  rxpk.Mod,
+		"data rate":   rxpk.DatR,
+		"coding rate": rxpk.CodR,
+		"rssi":        rxpk.RSSI,
+		"size":        rxpk.Size,
+		"data":        rxpk.Data,
+	}
+	if rxpk.SNR != nil {
+		fields["snr"] = *rxpk.SNR
+	}
+	if rxpk.Time != nil {
+		fields["time"] = time.Time(*rxpk.Time)
+	}
+	if rxpk.TMMS != nil {
+		fields["gps time"] = *rxpk.TMMS
+	}
+	if rxpk.Brd != nil {
+		fields["board"] = *rxpk.Brd
 	}
+	if rxpk.Ant != nil {
+		fields["antenna"] = *rxpk.Ant
+	}
+	if rxpk.RSSIS != nil {
+		fields["rssi signal"] = *rxpk.RSSIS
+	}
+	if rxpk.RSSIC != nil {
+		fields["rssi channel"] = *rxpk.RSSIC
+	}
+	if rxpk.FOff != nil {
+		fields["freq offset"] = *rxpk.FOff
+	}
+	addFields(fields, dataRateFields(rxpk.DatR))
+	addFields(fields, codingRateFields(rxpk.CodR))
+	addFields(fields, airtimeFields(rxpk.Airtime()))
+	addFields(fields, rxpk.Region)
+	addFields(fields, rsigFields(rxpk.RSig))
+	addFields(fields, extraFields(rxpk.Extra))
+	addFields(fields, frameFields(rxpk.Frame, rxpk.Data))
 
-	return &pushDataPacket, nil
+	return fields
 }
 
 func (p *PushDataPacket) Log(ctx log.Interface) {
@@ -173,20 +273,7 @@ func (p *PushDataPacket) Log(ctx log.Interface) {
 	})
 
 	for _, rxpk := range p.Payload.RXPK {
-		ctx.WithFields(log.Fields{
-			"time":        time.Time(rxpk.Time),
-			"frequency":   rxpk.Freq,
-			"IF channel":  rxpk.Chan,
-			"RF chain":    rxpk.RFCh,
-			"crc":         rxpk.Stat,
-			"modulation":  rxpk.Mod,
-			"data rate":   rxpk.DatR,
-			"coding rate": rxpk.CodR,
-			"rssi":        rxpk.RSSI,
-			"snr":         rxpk.SNR,
-			"size":        rxpk.Size,
-			"data":        rxpk.Data,
-		}).Info("PUSH_DATA: RXPK")
+		ctx.WithFields(rxpk.Fields()).Info("PUSH_DATA: RXPK")
 	}
 
 	if p.Payload.Stat != nil {
@@ -198,11 +285,28 @@ func (p *PushDataPacket) Log(ctx log.Interface) {
 			"upstream ack (%)":    p.Payload.Stat.ACKR,
 			"downstream received": p.Payload.Stat.DWNb,
 			"tx ps":               p.Payload.Stat.TXNb,
-		}).Info("PUSH_DATA: STAT")
+			"platform":            p.Payload.Stat.Pfrm,
+			"mail":                p.Payload.Stat.Mail,
+			"description":         p.Payload.Stat.Desc,
+		}).WithFields(extraFields(p.Payload.Stat.Extra)).Info("PUSH_DATA: STAT")
 	}
 }
 
-func (p *PushDataPacket) unmarshalData(data []byte) error {
+// MarshalBinary implements the encoding.BinaryMarshaler interface for PushDataPacket.
+func (p *PushDataPacket) MarshalBinary() ([]byte, error) {
+	data := marshalHeader(p.Protocol, p.RandomToken, PushData)
+	data = append(data, p.GatewayMac[:]...)
+
+	payload, err := json.Marshal(p.Payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal push data packet failed")
+	}
+
+	return append(data, payload...), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for PushDataPacket.
+func (p *PushDataPacket) UnmarshalBinary(data []byte) error {
 	_, err := isValidPushDataPacket(data)
 	if err != nil {
 		return errors.Wrap(err, "unmarshal push data packet failed")
@@ -223,5 +327,5 @@ func isValidPushDataPacket(data []byte) (bool, error) {
 		return false, errors.New("invalid packet: at least 12 bytes expected")
 	}
 
-	return true, nil
+	return isPacketType(data, PushData)
 }
@@ -0,0 +1,102 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"github.com/apex/log"
+	"github.com/bullettime/lora-logger/region"
+)
+
+// RegionAnnotator annotates RF packets with their channel and data rate
+// index in a regional channel plan.
+type RegionAnnotator struct {
+	plan *region.Plan
+}
+
+// NewRegionAnnotator returns an annotator using the channel plan.
+func NewRegionAnnotator(plan *region.Plan) *RegionAnnotator {
+	return &RegionAnnotator{
+		plan: plan,
+	}
+}
+
+// Annotate annotates the RF packets of a PUSH_DATA or PULL_RESP, they are
+// logged with the packet. Other packets are ignored.
+func (a *RegionAnnotator) Annotate(p Packet) {
+	switch p := p.(type) {
+	case *PushDataPacket:
+		for i := range p.Payload.RXPK {
+			a.AnnotateRXPK(&p.Payload.RXPK[i])
+		}
+	case *PullRespPacket:
+		txpk := &p.Payload.TXPK
+		txpk.Region = regionFields(a.plan, false, txpk.Freq, &txpk.DatR)
+	}
+}
+
+// AnnotateRXPK annotates the received packet, it is logged with the packet.
+func (a *RegionAnnotator) AnnotateRXPK(rxpk *RXPK) {
+	rxpk.Region = regionFields(a.plan, true, rxpk.Freq, rxpk.DatR)
+}
+
+// regionFields returns the channel and data rate index of an RX or TX packet
+// in the channel plan and flags packets outside the plan.
+func regionFields(plan *region.Plan, uplink bool, freq float64, dataRate *DataRate) log.Fields {
+	lookup, ok := regionLookup(plan, uplink, freq, dataRate)
+	if !ok {
+		return nil
+	}
+
+	fields := log.Fields{
+		"region":  plan.Name,
+		"in plan": lookup.InPlan,
+	}
+	if lookup.RX2 {
+		fields["channel"] = "RX2"
+	} else if lookup.Channel >= 0 {
+		fields["channel"] = lookup.Channel
+	}
+	if lookup.DataRate >= 0 {
+		fields["dr"] = lookup.DataRate
+	}
+
+	return fields
+}
+
+// regionLookup returns the channel and data rate index of an RX or TX packet
+// in the channel plan, ok is false without channel plan.
+func regionLookup(plan *region.Plan, uplink bool, freq float64, dataRate *DataRate) (lookup region.Lookup, ok bool) {
+	if plan == nil || dataRate == nil || dataRate.Validate() != nil {
+		return region.Lookup{}, false
+	}
+
+	var dr region.DataRate
+	switch dataRate.Modulation {
+	case LoRa:
+		dr = region.LoRa(dataRate.SpreadingFactor, uint16(dataRate.Bandwidth/1000))
+	case FSK:
+		dr = region.FSK(dataRate.BitRate)
+	}
+
+	return plan.Lookup(uplink, region.Hz(freq), dr), true
+}
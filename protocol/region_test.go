@@ -0,0 +1,67 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package protocol
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/bullettime/lora-logger/region"
+)
+
+func TestRegionAnnotator(t *testing.T) {
+	plan, err := region.Get("US915", 0)
+	if err != nil {
+		t.Fatalf("get region failed: %v", err)
+	}
+	a := NewRegionAnnotator(plan)
+
+	push := &PushDataPacket{Payload: PushDataPayload{RXPK: []RXPK{
+		{Freq: 903.0, DatR: &DataRate{Modulation: LoRa, SpreadingFactor: 8, Bandwidth: 500000}},
+		{Freq: 904.0, DatR: &DataRate{Modulation: LoRa, SpreadingFactor: 8, Bandwidth: 500000}},
+		{Freq: 902.3, DatR: &DataRate{Raw: `"SF99BW1"`}},
+	}}}
+	a.Annotate(push)
+
+	want := []log.Fields{
+		{"region": "US915", "in plan": true, "channel": 64, "dr": 4},
+		{"region": "US915", "in plan": false, "dr": 4},
+		nil,
+	}
+	for i, fields := range want {
+		if got := push.Payload.RXPK[i].Region; !reflect.DeepEqual(got, fields) {
+			t.Errorf("rxpk %d: region %v, expected %v", i, got, fields)
+		}
+	}
+
+	pull := &PullRespPacket{Payload: PullRespPayload{TXPK: TXPK{
+		Freq: 923.3,
+		DatR: DataRate{Modulation: LoRa, SpreadingFactor: 8, Bandwidth: 500000},
+	}}}
+	a.Annotate(pull)
+
+	fields := log.Fields{"region": "US915", "in plan": true, "channel": 0, "dr": 12}
+	if got := pull.Payload.TXPK.Region; !reflect.DeepEqual(got, fields) {
+		t.Errorf("txpk: region %v, expected %v", got, fields)
+	}
+}
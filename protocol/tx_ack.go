@@ -23,6 +23,7 @@
 package protocol
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
@@ -47,15 +48,140 @@ type TXAckPayload struct {
 }
 
 // TXPKACK contains the status information of the associated PULL_RESP
-// packet.
+// packet. Error is NONE when the downlink was accepted, newer packet
+// forwarders report a Warn when they had to change the downlink (eg. lower
+// the TX power). Statuses that are not known are UNKNOWN, their text is
+// kept in ErrorText and WarnText. Keys that are not known (eg. the value
+// sent with a TX_POWER warning) are kept in Extra.
 type TXPKACK struct {
-	Error string `json:"error"`
+	Error     TXAckError `json:"error"`
+	Warn      TXAckError `json:"warn,omitempty"`
+	ErrorText string     `json:"-"`
+	WarnText  string     `json:"-"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for TXPKACK.
+func (t *TXPKACK) UnmarshalJSON(data []byte) error {
+	var text struct {
+		Error string `json:"error"`
+		Warn  string `json:"warn"`
+	}
+	extra, err := unmarshalJSONExtra(data, &text)
+	if err != nil {
+		return err
+	}
+
+	*t = TXPKACK{Extra: extra}
+	t.Error.UnmarshalText([]byte(text.Error))
+	if t.Error == TXAckUnknown {
+		t.ErrorText = text.Error
+	}
+	t.Warn.UnmarshalText([]byte(text.Warn))
+	if t.Warn == TXAckUnknown {
+		t.WarnText = text.Warn
+	}
+
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface for TXPKACK.
+func (t TXPKACK) MarshalJSON() ([]byte, error) {
+	text := struct {
+		Error string `json:"error"`
+		Warn  string `json:"warn,omitempty"`
+	}{
+		Error: t.ErrorString(),
+	}
+	if t.Warn != TXAckNone {
+		text.Warn = t.WarnString()
+	}
+	return marshalJSONExtra(text, t.Extra)
+}
+
+// ErrorString returns the error status, as sent for unknown statuses.
+func (t TXPKACK) ErrorString() string {
+	if t.Error == TXAckUnknown && len(t.ErrorText) > 0 {
+		return t.ErrorText
+	}
+	return t.Error.String()
+}
+
+// WarnString returns the warning status, as sent for unknown statuses.
+func (t TXPKACK) WarnString() string {
+	if t.Warn == TXAckUnknown && len(t.WarnText) > 0 {
+		return t.WarnText
+	}
+	return t.Warn.String()
+}
+
+// TXAckError defines the status reported in a TX_ACK.
+type TXAckError uint8
+
+// Available TX_ACK statuses
+const (
+	TXAckNone            TXAckError = iota // Packet has been programmed for downlink
+	TXAckTooLate                           // Rejected because it was already too late to program this packet for downlink
+	TXAckTooEarly                          // Rejected because downlink packet timestamp is too much in advance
+	TXAckCollisionPacket                   // Rejected because there was already a packet programmed in requested timeframe
+	TXAckCollisionBeacon                   // Rejected because there was already a beacon planned in requested timeframe
+	TXAckTXFreq                            // Rejected because requested frequency is not supported by TX RF chain
+	TXAckTXPower                           // Rejected because requested power is not supported by gateway
+	TXAckGPSUnlocked                       // Rejected because GPS is unlocked, so GPS timestamp cannot be used
+	TXAckUnknown                           // Status not known by this package
+)
+
+var txAckErrorNames = [...]string{
+	TXAckNone:            "NONE",
+	TXAckTooLate:         "TOO_LATE",
+	TXAckTooEarly:        "TOO_EARLY",
+	TXAckCollisionPacket: "COLLISION_PACKET",
+	TXAckCollisionBeacon: "COLLISION_BEACON",
+	TXAckTXFreq:          "TX_FREQ",
+	TXAckTXPower:         "TX_POWER",
+	TXAckGPSUnlocked:     "GPS_UNLOCKED",
+	TXAckUnknown:         "UNKNOWN",
+}
+
+// String implements the stringer interface for TXAckError.
+func (e TXAckError) String() string {
+	if int(e) >= len(txAckErrorNames) {
+		return fmt.Sprintf("TXAckError(%d)", e)
+	}
+	return txAckErrorNames[e]
+}
+
+// MarshalText implements the encoding.TextMarshaler interface for TXAckError.
+func (e TXAckError) MarshalText() ([]byte, error) {
+	if int(e) >= len(txAckErrorNames) {
+		return nil, errors.New(fmt.Sprintf("unknown tx ack error: %d", e))
+	}
+	return []byte(e.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface for
+// TXAckError. An empty status is NONE, a status that is not known is
+// UNKNOWN.
+func (e *TXAckError) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*e = TXAckNone
+		return nil
+	}
+	for i, name := range txAckErrorNames {
+		if name == string(text) {
+			*e = TXAckError(i)
+			return nil
+		}
+	}
+	*e = TXAckUnknown
+	return nil
 }
 
 func handleTXAck(data []byte) (Packet, error) {
-	var packet PullAckPacket
+	var packet TXAckPacket
 
-	err := packet.unmarshalData(data)
+	err := packet.UnmarshalBinary(data)
 	if err != nil {
 		return nil, errors.Wrap(err, "handle tx ack packet failed")
 	}
@@ -63,16 +189,68 @@ func handleTXAck(data []byte) (Packet, error) {
 	return &packet, nil
 }
 
+// Type implements the Packet interface for TXAckPacket.
+func (p *TXAckPacket) Type() PacketType {
+	return TXAck
+}
+
+// ProtocolVersion implements the Packet interface for TXAckPacket.
+func (p *TXAckPacket) ProtocolVersion() uint8 {
+	return p.Protocol
+}
+
+// Token implements the Packet interface for TXAckPacket.
+func (p *TXAckPacket) Token() uint16 {
+	return p.RandomToken
+}
+
+// GatewayEUI implements the Packet interface for TXAckPacket.
+func (p *TXAckPacket) GatewayEUI() ([8]byte, bool) {
+	return p.GatewayMac, true
+}
+
+// Direction implements the Packet interface for TXAckPacket.
+func (p *TXAckPacket) Direction() Direction {
+	return Uplink
+}
+
 func (p *TXAckPacket) Log(ctx log.Interface) {
-	ctx.WithFields(log.Fields{
+	ctx = ctx.WithFields(log.Fields{
 		"protocol":     p.Protocol,
 		"random token": p.RandomToken,
 		"gateway mac":  fmt.Sprintf("%X", p.GatewayMac),
-		"error":        p.Payload.TXPKACK.Error,
-	}).Info("TX_ACK")
+		"error":        p.Payload.TXPKACK.ErrorString(),
+	})
+
+	if p.Payload.TXPKACK.Warn != TXAckNone {
+		ctx = ctx.WithField("warning", p.Payload.TXPKACK.WarnString())
+	}
+	ctx = ctx.WithFields(extraFields(p.Payload.TXPKACK.Extra))
+
+	// make rejected downlinks stand out
+	if p.Payload.TXPKACK.Error != TXAckNone {
+		ctx.Warn("TX_ACK: downlink rejected")
+		return
+	}
+
+	ctx.Info("TX_ACK")
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface for TXAckPacket.
+func (p *TXAckPacket) MarshalBinary() ([]byte, error) {
+	data := marshalHeader(p.Protocol, p.RandomToken, TXAck)
+	data = append(data, p.GatewayMac[:]...)
+
+	payload, err := json.Marshal(p.Payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal tx ack packet failed")
+	}
+
+	return append(data, payload...), nil
 }
 
-func (p *TXAckPacket) unmarshalData(data []byte) error {
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for TXAckPacket.
+func (p *TXAckPacket) UnmarshalBinary(data []byte) error {
 	_, err := isValidTXAckPacket(data)
 	if err != nil {
 		return errors.Wrap(err, "unmarshal tx ack packet failed")
@@ -85,7 +263,15 @@ func (p *TXAckPacket) unmarshalData(data []byte) error {
 		p.GatewayMac[i] = data[4+i]
 	}
 
-	return json.Unmarshal(data[12:], p.Payload)
+	// an empty payload means no error occurred, some packet forwarders
+	// terminate the payload with a null byte
+	p.Payload = TXAckPayload{}
+	payload := bytes.TrimRight(data[12:], "\x00")
+	if len(bytes.TrimSpace(payload)) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(payload, &p.Payload)
 }
 
 func isValidTXAckPacket(data []byte) (bool, error) {
@@ -93,5 +279,5 @@ func isValidTXAckPacket(data []byte) (bool, error) {
 		return false, errors.New("invalid packet: at least 12 bytes expected")
 	}
 
-	return true, nil
+	return isPacketType(data, TXAck)
 }
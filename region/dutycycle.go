@@ -0,0 +1,167 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package region
+
+import (
+	"sync"
+	"time"
+)
+
+// DutyCycleWindow is the sliding window over which the duty cycle is
+// calculated.
+const DutyCycleWindow = time.Hour
+
+// SubBand is a frequency band (in Hz) with its maximum duty cycle, as
+// defined by the regulations of the region (eg. ETSI EN 300 220 in EU868).
+// The minimum frequency is inclusive and the maximum frequency exclusive, so
+// adjacent sub-bands do not overlap.
+type SubBand struct {
+	Name         string
+	MinFrequency uint32
+	MaxFrequency uint32
+	DutyCycle    float64 // fraction of the time, eg. 0.01 for 1%
+}
+
+// SubBand returns the duty cycle sub-band of the frequency (in Hz), false
+// is returned when the region has no duty cycle limit for the frequency.
+func (p *Plan) SubBand(frequency uint32) (SubBand, bool) {
+	for _, subBand := range p.SubBands {
+		if frequency >= subBand.MinFrequency && frequency < subBand.MaxFrequency {
+			return subBand, true
+		}
+	}
+	return SubBand{}, false
+}
+
+// Utilisation is the airtime used by a gateway in a sub-band within the
+// duty cycle window.
+type Utilisation struct {
+	Gateway   string
+	SubBand   SubBand
+	Airtime   time.Duration
+	DutyCycle float64 // fraction of the window
+}
+
+// OverLimit returns true when the utilisation exceeds the duty cycle limit
+// of the sub-band.
+func (u Utilisation) OverLimit() bool {
+	return u.DutyCycle > u.SubBand.DutyCycle
+}
+
+type transmission struct {
+	time    time.Time
+	airtime time.Duration
+}
+
+type dutyCycleKey struct {
+	gateway string
+	subBand string
+}
+
+// DutyCycleMonitor tracks the transmitted airtime per gateway and sub-band
+// in a sliding window.
+type DutyCycleMonitor struct {
+	mu            sync.Mutex
+	plan          *Plan
+	window        time.Duration
+	transmissions map[dutyCycleKey][]transmission
+}
+
+// NewDutyCycleMonitor returns a duty cycle monitor for the sub-bands of the
+// channel plan.
+func NewDutyCycleMonitor(plan *Plan, window time.Duration) *DutyCycleMonitor {
+	return &DutyCycleMonitor{
+		plan:          plan,
+		window:        window,
+		transmissions: make(map[dutyCycleKey][]transmission),
+	}
+}
+
+// Add records a transmission of the gateway at the given time and frequency
+// (in Hz) and returns the utilisation of the sub-band. False is returned
+// when the frequency has no duty cycle limit.
+func (m *DutyCycleMonitor) Add(gateway string, t time.Time, frequency uint32, airtime time.Duration) (Utilisation, bool) {
+	subBand, ok := m.plan.SubBand(frequency)
+	if !ok {
+		return Utilisation{}, false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := dutyCycleKey{gateway, subBand.Name}
+	m.transmissions[key] = append(m.transmissions[key], transmission{t, airtime})
+
+	return m.utilisation(key, subBand, t), true
+}
+
+// Expire removes the transmissions of all gateways and sub-bands that left
+// the window at the given time, so idle keys do not keep their entries.
+func (m *DutyCycleMonitor) Expire(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key := range m.transmissions {
+		m.prune(key, t)
+	}
+}
+
+// prune removes the transmissions of the key that left the window at the
+// given time and returns the remaining ones.
+func (m *DutyCycleMonitor) prune(key dutyCycleKey, t time.Time) []transmission {
+	start := t.Add(-m.window)
+	transmissions := m.transmissions[key]
+
+	i := 0
+	for i < len(transmissions) && !transmissions[i].time.After(start) {
+		i++
+	}
+	transmissions = transmissions[i:]
+	if len(transmissions) == 0 {
+		delete(m.transmissions, key)
+	} else {
+		m.transmissions[key] = transmissions
+	}
+
+	return transmissions
+}
+
+// utilisation removes the transmissions that left the window and sums the
+// airtime of the remaining ones.
+func (m *DutyCycleMonitor) utilisation(key dutyCycleKey, subBand SubBand, t time.Time) Utilisation {
+	transmissions := m.prune(key, t)
+
+	u := Utilisation{
+		Gateway: key.gateway,
+		SubBand: subBand,
+	}
+	for _, tx := range transmissions {
+		if tx.time.After(t) {
+			continue
+		}
+		u.Airtime += tx.airtime
+	}
+	u.DutyCycle = float64(u.Airtime) / float64(m.window)
+
+	return u
+}
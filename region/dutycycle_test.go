@@ -0,0 +1,149 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package region
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubBand(t *testing.T) {
+	tests := []struct {
+		frequency uint32
+		name      string
+		dutyCycle float64
+		ok        bool
+	}{
+		{862900000, "", 0, false},
+		{863000000, "h1.3", 0.001, true},
+		{864900000, "h1.3", 0.001, true},
+		{865000000, "g", 0.01, true},
+		{867900000, "g", 0.01, true},
+		{868000000, "g1", 0.01, true},
+		{868500000, "g1", 0.01, true},
+		{868600000, "", 0, false},
+		{868800000, "g2", 0.001, true},
+		{869300000, "", 0, false},
+		{869525000, "g3", 0.1, true},
+		{869650000, "", 0, false},
+		{869850000, "g4", 0.01, true},
+		{870000000, "", 0, false},
+	}
+
+	plan, err := Get("EU868", 0)
+	if err != nil {
+		t.Fatalf("get region failed: %v", err)
+	}
+
+	for _, test := range tests {
+		subBand, ok := plan.SubBand(test.frequency)
+		if ok != test.ok || subBand.Name != test.name || subBand.DutyCycle != test.dutyCycle {
+			t.Errorf("%d Hz: sub-band %+v (%t), expected %s at %v", test.frequency, subBand, ok, test.name, test.dutyCycle)
+		}
+	}
+
+	plan, err = Get("US915", 0)
+	if err != nil {
+		t.Fatalf("get region failed: %v", err)
+	}
+	if subBand, ok := plan.SubBand(923300000); ok {
+		t.Errorf("us915 sub-band %+v, expected no duty cycle limit", subBand)
+	}
+}
+
+func TestDutyCycleMonitor(t *testing.T) {
+	plan, err := Get("EU868", 0)
+	if err != nil {
+		t.Fatalf("get region failed: %v", err)
+	}
+	m := NewDutyCycleMonitor(plan, time.Minute)
+	start := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		gateway   string
+		offset    time.Duration
+		frequency uint32
+		airtime   time.Duration
+		subBand   string
+		total     time.Duration
+		overLimit bool
+	}{
+		{"first transmission", "a", 0, 868100000, 600 * time.Millisecond, "g1", 600 * time.Millisecond, false},
+		{"same sub-band", "a", 30 * time.Second, 868300000, 600 * time.Millisecond, "g1", 1200 * time.Millisecond, true},
+		{"other gateway", "b", 30 * time.Second, 868100000, 100 * time.Millisecond, "g1", 100 * time.Millisecond, false},
+		{"other sub-band", "a", 30 * time.Second, 867100000, 100 * time.Millisecond, "g", 100 * time.Millisecond, false},
+		{"first transmission left the window", "a", time.Minute, 868500000, 100 * time.Millisecond, "g1", 700 * time.Millisecond, true},
+		{"all transmissions left the window", "a", 2 * time.Minute, 868100000, 60 * time.Millisecond, "g1", 60 * time.Millisecond, false},
+	}
+
+	for _, test := range tests {
+		u, ok := m.Add(test.gateway, start.Add(test.offset), test.frequency, test.airtime)
+		if !ok {
+			t.Errorf("%s: no duty cycle limit", test.name)
+			continue
+		}
+		if u.Gateway != test.gateway || u.SubBand.Name != test.subBand {
+			t.Errorf("%s: utilisation of %s in %s, expected %s in %s", test.name, u.Gateway, u.SubBand.Name, test.gateway, test.subBand)
+		}
+		if u.Airtime != test.total {
+			t.Errorf("%s: airtime %s, expected %s", test.name, u.Airtime, test.total)
+		}
+		if want := float64(test.total) / float64(time.Minute); u.DutyCycle != want {
+			t.Errorf("%s: duty cycle %v, expected %v", test.name, u.DutyCycle, want)
+		}
+		if u.OverLimit() != test.overLimit {
+			t.Errorf("%s: over limit %t, expected %t", test.name, u.OverLimit(), test.overLimit)
+		}
+	}
+
+	if _, ok := m.Add("a", start, 869300000, time.Second); ok {
+		t.Error("utilisation of a frequency without duty cycle limit")
+	}
+}
+
+func TestDutyCycleMonitorExpire(t *testing.T) {
+	plan, err := Get("EU868", 0)
+	if err != nil {
+		t.Fatalf("get region failed: %v", err)
+	}
+	m := NewDutyCycleMonitor(plan, time.Minute)
+	start := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	m.Add("a", start, 868100000, time.Second)
+	m.Add("a", start.Add(30*time.Second), 868100000, time.Second)
+	m.Add("b", start, 868100000, time.Second)
+	m.Add("b", start, 867100000, time.Second)
+
+	m.Expire(start.Add(time.Minute))
+	if len(m.transmissions) != 1 {
+		t.Errorf("%d keys after the first transmissions expired, expected 1", len(m.transmissions))
+	}
+	if transmissions := m.transmissions[dutyCycleKey{"a", "g1"}]; len(transmissions) != 1 {
+		t.Errorf("%d transmissions of gateway a in g1, expected 1", len(transmissions))
+	}
+
+	m.Expire(start.Add(2 * time.Minute))
+	if len(m.transmissions) != 0 {
+		t.Errorf("%d keys after all transmissions expired, expected none", len(m.transmissions))
+	}
+}
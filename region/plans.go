@@ -0,0 +1,188 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package region
+
+// The channel plans follow the LoRaWAN Regional Parameters. Where a region
+// only defines default channels, the additional channels most networks
+// configure (eg. 867.1 - 867.9 MHz in EU868) are included.
+
+func init() {
+	plans["EU868"] = eu868
+	plans["US915"] = us915
+	plans["AS923"] = as923
+	plans["AU915"] = au915
+	plans["CN470"] = cn470
+	plans["IN865"] = in865
+	plans["KR920"] = kr920
+}
+
+// loraDataRates125 returns DR0 (SF12) to DR5 (SF7) at 125 kHz.
+func loraDataRates125() map[int]DataRate {
+	return map[int]DataRate{
+		0: LoRa(12, 125),
+		1: LoRa(11, 125),
+		2: LoRa(10, 125),
+		3: LoRa(9, 125),
+		4: LoRa(8, 125),
+		5: LoRa(7, 125),
+	}
+}
+
+func eu868() *Plan {
+	dataRates := loraDataRates125()
+	dataRates[6] = LoRa(7, 250)
+	dataRates[7] = FSK(50000)
+
+	return &Plan{
+		Name:      "EU868",
+		DataRates: dataRates,
+		UplinkChannels: []Channel{
+			{868100000, 0, 5},
+			{868300000, 0, 5},
+			{868500000, 0, 5},
+			{867100000, 0, 5},
+			{867300000, 0, 5},
+			{867500000, 0, 5},
+			{867700000, 0, 5},
+			{867900000, 0, 5},
+			{868300000, 6, 6},
+			{868800000, 7, 7},
+		},
+		RX2Channel: Channel{869525000, 0, 7},
+		SubBands: []SubBand{
+			{"h1.3", 863000000, 865000000, 0.001}, // ERC/REC 70-03 band
+			{"g", 865000000, 868000000, 0.01},
+			{"g1", 868000000, 868600000, 0.01},
+			{"g2", 868700000, 869200000, 0.001},
+			{"g3", 869400000, 869650000, 0.1},
+			{"g4", 869700000, 870000000, 0.01},
+		},
+	}
+}
+
+func us915() *Plan {
+	return &Plan{
+		Name: "US915",
+		DataRates: map[int]DataRate{
+			0:  LoRa(10, 125),
+			1:  LoRa(9, 125),
+			2:  LoRa(8, 125),
+			3:  LoRa(7, 125),
+			4:  LoRa(8, 500),
+			8:  LoRa(12, 500),
+			9:  LoRa(11, 500),
+			10: LoRa(10, 500),
+			11: LoRa(9, 500),
+			12: LoRa(8, 500),
+			13: LoRa(7, 500),
+		},
+		UplinkChannels:   append(channels(902300000, 200000, 64, 0, 3), channels(903000000, 1600000, 8, 4, 4)...),
+		DownlinkChannels: channels(923300000, 600000, 8, 8, 13),
+		RX2Channel:       Channel{923300000, 8, 13},
+	}
+}
+
+func as923() *Plan {
+	dataRates := loraDataRates125()
+	dataRates[6] = LoRa(7, 250)
+	dataRates[7] = FSK(50000)
+
+	return &Plan{
+		Name:      "AS923",
+		DataRates: dataRates,
+		UplinkChannels: []Channel{
+			{923200000, 0, 5},
+			{923400000, 0, 5},
+			{922200000, 0, 5},
+			{922400000, 0, 5},
+			{922600000, 0, 5},
+			{922800000, 0, 5},
+			{923000000, 0, 5},
+			{922000000, 0, 5},
+			{922100000, 6, 6},
+			{921800000, 7, 7},
+		},
+		RX2Channel: Channel{923200000, 0, 7},
+	}
+}
+
+func au915() *Plan {
+	dataRates := loraDataRates125()
+	dataRates[6] = LoRa(8, 500)
+	for dr, sf := 8, uint8(12); sf >= 7; dr, sf = dr+1, sf-1 {
+		dataRates[dr] = LoRa(sf, 500)
+	}
+
+	return &Plan{
+		Name:             "AU915",
+		DataRates:        dataRates,
+		UplinkChannels:   append(channels(915200000, 200000, 64, 0, 5), channels(915900000, 1600000, 8, 6, 6)...),
+		DownlinkChannels: channels(923300000, 600000, 8, 8, 13),
+		RX2Channel:       Channel{923300000, 8, 13},
+	}
+}
+
+func cn470() *Plan {
+	downlink := channels(500300000, 200000, 48, 0, 5)
+
+	return &Plan{
+		Name:             "CN470",
+		DataRates:        loraDataRates125(),
+		UplinkChannels:   channels(470300000, 200000, 96, 0, 5),
+		DownlinkChannels: append(downlink, downlink...),
+		RX2Channel:       Channel{505300000, 0, 5},
+	}
+}
+
+func in865() *Plan {
+	dataRates := loraDataRates125()
+	dataRates[7] = FSK(50000)
+
+	return &Plan{
+		Name:      "IN865",
+		DataRates: dataRates,
+		UplinkChannels: []Channel{
+			{865062500, 0, 5},
+			{865402500, 0, 5},
+			{865985000, 0, 5},
+		},
+		RX2Channel: Channel{866550000, 0, 7},
+	}
+}
+
+func kr920() *Plan {
+	return &Plan{
+		Name:      "KR920",
+		DataRates: loraDataRates125(),
+		UplinkChannels: []Channel{
+			{922100000, 0, 5},
+			{922300000, 0, 5},
+			{922500000, 0, 5},
+			{922700000, 0, 5},
+			{922900000, 0, 5},
+			{923100000, 0, 5},
+			{923300000, 0, 5},
+		},
+		RX2Channel: Channel{921900000, 0, 5},
+	}
+}
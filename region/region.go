@@ -0,0 +1,236 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package region describes the regional channel plans, so the frequency and
+// data rate of a packet can be mapped to a channel and data rate index.
+package region
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DataRate describes the modulation of a data rate index. FSK data rates
+// have no spreading factor.
+type DataRate struct {
+	SpreadingFactor uint8  // LoRa spreading factor
+	Bandwidth       uint16 // LoRa bandwidth in kHz
+	BitRate         uint32 // FSK bit rate in bits per second
+}
+
+// LoRa returns a LoRa data rate.
+func LoRa(spreadingFactor uint8, bandwidth uint16) DataRate {
+	return DataRate{SpreadingFactor: spreadingFactor, Bandwidth: bandwidth}
+}
+
+// FSK returns an FSK data rate.
+func FSK(bitRate uint32) DataRate {
+	return DataRate{BitRate: bitRate}
+}
+
+// Channel is a frequency (in Hz) with the range of data rates it may use.
+type Channel struct {
+	Frequency uint32
+	MinDR     int
+	MaxDR     int
+}
+
+// Plan is the channel plan of a region.
+type Plan struct {
+	Name string
+
+	// DataRates maps the data rate index to its modulation.
+	DataRates map[int]DataRate
+
+	// UplinkChannels are the channels the end-devices transmit on, the
+	// index in the slice is the channel index.
+	UplinkChannels []Channel
+
+	// DownlinkChannels are the RX1 channels, when nil the gateway answers
+	// on the uplink channel.
+	DownlinkChannels []Channel
+
+	// RX2Channel is the channel of the second receive window.
+	RX2Channel Channel
+
+	// SubBands are the regulatory sub-bands with a duty cycle limit.
+	SubBands []SubBand
+
+	// enabled contains the enabled uplink channels, all are enabled when
+	// nil.
+	enabled map[int]bool
+}
+
+// Lookup is the result of mapping a packet on the channel plan. Channel is
+// -1 for the RX2 channel or when the frequency is not part of the plan,
+// DataRate is -1 when the data rate is not part of the plan.
+type Lookup struct {
+	Channel  int
+	DataRate int
+	RX2      bool
+	InPlan   bool
+}
+
+// plans contains the channel plans by name.
+var plans = map[string]func() *Plan{}
+
+// Names returns the names of the available channel plans.
+func Names() []string {
+	names := make([]string, 0, len(plans))
+	for name := range plans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the channel plan with the given name. For regions with more
+// uplink channels than a gateway can listen to (US915, AU915 and CN470), a
+// sub-band of 8 channels can be selected, 0 enables all channels.
+func Get(name string, subBand int) (*Plan, error) {
+	newPlan, ok := plans[strings.ToUpper(name)]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("unknown region: %s", name))
+	}
+
+	plan := newPlan()
+	if subBand != 0 {
+		err := plan.enableSubBand(subBand)
+		if err != nil {
+			return nil, errors.Wrap(err, "get region failed")
+		}
+	}
+
+	return plan, nil
+}
+
+// enableSubBand enables the 8 125 kHz channels of the sub-band and, for the
+// regions that have them, the matching 500 kHz channel.
+func (p *Plan) enableSubBand(subBand int) error {
+	count125 := len(p.UplinkChannels)
+	if p.Name == "US915" || p.Name == "AU915" {
+		count125 = 64
+	}
+
+	if count125 <= 16 || subBand < 1 || subBand > count125/8 {
+		return errors.New(fmt.Sprintf("invalid sub-band %d for region %s", subBand, p.Name))
+	}
+
+	p.enabled = make(map[int]bool)
+	for i := (subBand - 1) * 8; i < subBand*8; i++ {
+		p.enabled[i] = true
+	}
+	if count125+subBand-1 < len(p.UplinkChannels) {
+		p.enabled[count125+subBand-1] = true
+	}
+
+	return nil
+}
+
+// Hz converts a frequency in MHz, as used by the packet forwarder, to Hz.
+func Hz(mhz float64) uint32 {
+	return uint32(math.Round(mhz * 1e6))
+}
+
+// Lookup maps the frequency (in Hz) and data rate of an uplink or downlink
+// on the channel plan.
+func (p *Plan) Lookup(uplink bool, frequency uint32, dataRate DataRate) Lookup {
+	l := Lookup{
+		Channel:  -1,
+		DataRate: -1,
+	}
+
+	channels := p.UplinkChannels
+	if !uplink && p.DownlinkChannels != nil {
+		channels = p.DownlinkChannels
+	}
+
+	for i, channel := range channels {
+		if channel.Frequency != frequency {
+			continue
+		}
+		if uplink && p.enabled != nil && !p.enabled[i] {
+			continue
+		}
+		if dr, ok := p.dataRateIndex(channel, dataRate); ok {
+			l.Channel = i
+			l.DataRate = dr
+			l.InPlan = true
+			return l
+		}
+	}
+
+	if !uplink && p.RX2Channel.Frequency == frequency {
+		if dr, ok := p.dataRateIndex(p.RX2Channel, dataRate); ok {
+			l.DataRate = dr
+			l.RX2 = true
+			l.InPlan = true
+			return l
+		}
+	}
+
+	// not part of the plan, but still report the data rate index if known,
+	// the lowest index when the data rate has more than one (eg. SF8BW500 is
+	// both DR4 and DR12 in US915)
+	indices := make([]int, 0, len(p.DataRates))
+	for dr := range p.DataRates {
+		indices = append(indices, dr)
+	}
+	sort.Ints(indices)
+	for _, dr := range indices {
+		if p.DataRates[dr] == dataRate {
+			l.DataRate = dr
+			break
+		}
+	}
+
+	return l
+}
+
+// dataRateIndex returns the data rate index within the range of the
+// channel.
+func (p *Plan) dataRateIndex(channel Channel, dataRate DataRate) (int, bool) {
+	for dr := channel.MinDR; dr <= channel.MaxDR; dr++ {
+		if d, ok := p.DataRates[dr]; ok && d == dataRate {
+			return dr, true
+		}
+	}
+	return -1, false
+}
+
+// channels returns count channels starting at first (in Hz) spaced by step
+// (in Hz).
+func channels(first, step uint32, count int, minDR, maxDR int) []Channel {
+	c := make([]Channel, count)
+	for i := range c {
+		c[i] = Channel{
+			Frequency: first + uint32(i)*step,
+			MinDR:     minDR,
+			MaxDR:     maxDR,
+		}
+	}
+	return c
+}
@@ -0,0 +1,122 @@
+// The MIT License (MIT)
+//
+// Copyright © 2017 Sven Agneessens <sven.agneessens@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package region
+
+import (
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name    string
+		region  string
+		subBand int
+		valid   bool
+	}{
+		{"eu868", "eu868", 0, true},
+		{"us915 sub-band", "US915", 2, true},
+		{"au915 last sub-band", "AU915", 8, true},
+		{"cn470 sub-band", "CN470", 12, true},
+		{"unknown region", "XX123", 0, false},
+		{"eu868 sub-band", "EU868", 1, false},
+		{"us915 sub-band out of range", "US915", 9, false},
+	}
+
+	for _, test := range tests {
+		_, err := Get(test.region, test.subBand)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: get returned %v", test.name, err)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name      string
+		region    string
+		subBand   int
+		uplink    bool
+		frequency uint32
+		dataRate  DataRate
+		lookup    Lookup
+	}{
+		{"eu868 uplink", "EU868", 0, true, 868100000, LoRa(7, 125), Lookup{0, 5, false, true}},
+		{"eu868 250 kHz uplink", "EU868", 0, true, 868300000, LoRa(7, 250), Lookup{8, 6, false, true}},
+		{"eu868 fsk uplink", "EU868", 0, true, 868800000, FSK(50000), Lookup{9, 7, false, true}},
+		{"eu868 rx1", "EU868", 0, false, 867500000, LoRa(9, 125), Lookup{5, 3, false, true}},
+		{"eu868 rx2", "EU868", 0, false, 869525000, LoRa(12, 125), Lookup{-1, 0, true, true}},
+		{"eu868 uplink on rx2", "EU868", 0, true, 869525000, LoRa(9, 125), Lookup{-1, 3, false, false}},
+		{"eu868 data rate outside channel", "EU868", 0, true, 868100000, LoRa(7, 250), Lookup{-1, 6, false, false}},
+		{"eu868 unknown data rate", "EU868", 0, true, 868100000, LoRa(7, 500), Lookup{-1, -1, false, false}},
+		{"us915 uplink", "US915", 0, true, 902300000, LoRa(10, 125), Lookup{0, 0, false, true}},
+		{"us915 500 kHz uplink", "US915", 0, true, 903000000, LoRa(8, 500), Lookup{64, 4, false, true}},
+		{"us915 rx1", "US915", 0, false, 923300000, LoRa(8, 500), Lookup{0, 12, false, true}},
+		{"us915 rx2", "US915", 0, false, 923300000, LoRa(12, 500), Lookup{0, 8, false, true}},
+		{"us915 duplicate data rate outside plan", "US915", 0, true, 904000000, LoRa(8, 500), Lookup{-1, 4, false, false}},
+		{"us915 sub-band 2", "US915", 2, true, 903900000, LoRa(10, 125), Lookup{8, 0, false, true}},
+		{"us915 sub-band 2 500 kHz", "US915", 2, true, 904600000, LoRa(8, 500), Lookup{65, 4, false, true}},
+		{"us915 outside sub-band 2", "US915", 2, true, 902300000, LoRa(10, 125), Lookup{-1, 0, false, false}},
+		{"au915 500 kHz uplink", "AU915", 0, true, 915900000, LoRa(8, 500), Lookup{64, 6, false, true}},
+		{"au915 duplicate data rate outside plan", "AU915", 0, false, 915900000, LoRa(8, 500), Lookup{-1, 6, false, false}},
+		{"as923 uplink", "AS923", 0, true, 923200000, LoRa(10, 125), Lookup{0, 2, false, true}},
+		{"cn470 rx1", "CN470", 0, false, 500300000, LoRa(12, 125), Lookup{0, 0, false, true}},
+		{"cn470 rx2 on rx1 channel 25", "CN470", 0, false, 505300000, LoRa(12, 125), Lookup{25, 0, false, true}},
+		{"in865 uplink", "IN865", 0, true, 865062500, LoRa(12, 125), Lookup{0, 0, false, true}},
+		{"kr920 uplink", "KR920", 0, true, 923300000, LoRa(7, 125), Lookup{6, 5, false, true}},
+	}
+
+	for _, test := range tests {
+		plan, err := Get(test.region, test.subBand)
+		if err != nil {
+			t.Errorf("%s: get failed: %v", test.name, err)
+			continue
+		}
+
+		// the data rates are a map, the lookup must not depend on the
+		// iteration order
+		for i := 0; i < 10; i++ {
+			lookup := plan.Lookup(test.uplink, test.frequency, test.dataRate)
+			if lookup != test.lookup {
+				t.Errorf("%s: lookup %+v, expected %+v", test.name, lookup, test.lookup)
+				break
+			}
+		}
+	}
+}
+
+func TestHz(t *testing.T) {
+	tests := []struct {
+		mhz float64
+		hz  uint32
+	}{
+		{868.1, 868100000},
+		{865.0625, 865062500},
+		{923.3, 923300000},
+		{869.525, 869525000},
+	}
+
+	for _, test := range tests {
+		if hz := Hz(test.mhz); hz != test.hz {
+			t.Errorf("%v MHz: %d Hz, expected %d", test.mhz, hz, test.hz)
+		}
+	}
+}